@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -8,6 +9,9 @@ import (
 
 var IsTUIMode = false
 
+// en mode json stdout ne contient que les lignes json, le reste part sur stderr
+var IsJSONMode = false
+
 const (
 	Reset   = "\033[0m"
 	Cyan    = "\033[36m"
@@ -41,6 +45,9 @@ func PrintBanner() {
 }
 
 func PrintSeparator() {
+	if IsJSONMode {
+		return
+	}
 	if IsTUIMode {
 		fmt.Println(Gray + strings.Repeat("─", 80) + Reset)
 	} else {
@@ -75,6 +82,9 @@ func PrintMetadataStart() {
 }
 
 func PrintMetadata(key, value string) {
+	if IsJSONMode {
+		return
+	}
 	maxValueLen := 60
 	displayValue := value
 	if len(value) > maxValueLen {
@@ -98,6 +108,9 @@ func PrintMetadata(key, value string) {
 }
 
 func PrintImageInfo(info string) {
+	if IsJSONMode {
+		return
+	}
 	if IsTUIMode {
 		fmt.Printf("%s│ %s└─ %s%s%s\n",
 			Cyan,
@@ -141,6 +154,8 @@ func PrintError(message string) {
 func PrintWarning(message string) {
 	if IsTUIMode {
 		fmt.Printf("%s[!] WARNING: %s%s\n", Yellow, message, Reset)
+	} else if IsJSONMode {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
 	} else {
 		fmt.Printf("Warning: %s\n", message)
 	}
@@ -149,12 +164,24 @@ func PrintWarning(message string) {
 func PrintSuccess(message string) {
 	if IsTUIMode {
 		fmt.Printf("%s[+] %s%s\n", Green, message, Reset)
+	} else if IsJSONMode {
+		fmt.Fprintf(os.Stderr, "%s\n", message)
 	} else {
 		fmt.Printf("%s\n", message)
 	}
 }
 
 func PrintCleanResult(fileType, outputPath string, originalSize, cleanedSize, metadataRemoved int) {
+	if IsJSONMode {
+		PrintJSON(map[string]any{
+			"format":           fileType,
+			"cleaned":          outputPath,
+			"original_size":    originalSize,
+			"cleaned_size":     cleanedSize,
+			"metadata_removed": metadataRemoved,
+		})
+		return
+	}
 	if IsTUIMode {
 		if metadataRemoved > 0 {
 			fmt.Printf("%s│ %s├─ %sMetadata removed:%s      %s%d bytes%s\n",
@@ -174,3 +201,13 @@ func PrintCleanResult(fileType, outputPath string, originalSize, cleanedSize, me
 			fileType, outputPath, originalSize, cleanedSize)
 	}
 }
+
+// une ligne json par resultat pour que les autres outils (spider) puissent lire la sortie
+func PrintJSON(v any) {
+	line, err := json.Marshal(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Println(string(line))
+}
@@ -91,6 +91,12 @@ func newJpeg() *Jpeg {
 		0x0111: "StripOffsets",
 		0x9101: "ComponentsConfiguration",
 		0x9203: "BrightnessValue",
+		0xA430: "CameraOwnerName",
+		0xA431: "BodySerialNumber",
+		0xA432: "LensSpecification",
+		0xA433: "LensMake",
+		0xA434: "LensModel",
+		0xA435: "LensSerialNumber",
 	}
 	jpeg.exifStartMarker = 0xE1
 	jpeg.Tags = make(map[string]string)
@@ -22,6 +22,7 @@ USAGE:
 OPTIONS:
   -c        Supprimer les métadonnées (crée <fichier>_clear.<ext>)
   -tui      Mode interactif avec navigation dans les dossiers
+  -json     Une ligne JSON par fichier (métadonnées ou résultat du nettoyage), sans bannière
   -h        Afficher cette aide
 
 FORMATS SUPPORTÉS:
@@ -34,7 +35,8 @@ EXEMPLES:
   scorpion image.jpg                 # Affiche les métadonnées
   scorpion -c image.jpg              # Crée image_clear.jpg
   scorpion -tui                      # Mode interactif
-  scorpion *.jpg *.png               # Traite plusieurs fichiers`)
+  scorpion *.jpg *.png               # Traite plusieurs fichiers
+  scorpion -json image.jpg           # Métadonnées en JSON pour un autre programme (ex: spider)`)
 }
 
 func main() {
@@ -44,13 +46,19 @@ func main() {
 	scorpionBanner := `░█▄█░█▀▀░▀█▀░█▀█░█▀▄░█▀█░░░█▀▀░█░█░▀█▀░█▀▄░█▀█░█▀▀░▀█▀░█▀█░█▀▄
 ░█░█░█▀▀░░█░░█▀█░█░█░█▀█░░░█▀▀░▄▀▄░░█░░█▀▄░█▀█░█░░░░█░░█░█░█▀▄
 ░▀░▀░▀▀▀░░▀░░▀░▀░▀▀░░▀░▀░░░▀▀▀░▀░▀░░▀░░▀░▀░▀░▀░▀▀▀░░▀░░▀▀▀░▀░▀`
-	fmt.Println(scorpionBanner)
 
 	clearFlag := flag.Bool("c", false, "for clear metadata of file")
 	tuiFlag := flag.Bool("tui", false, "start interactive TUI mode")
+	jsonFlag := flag.Bool("json", false, "print one JSON line per file, for other tools")
 	helpFlag := flag.Bool("h", false, "show help")
 	flag.Parse() // Parse les arguments fournis par l'utilisateur
 
+	// pas de banniere en json sinon la sortie n'est plus lisible par un programme
+	IsJSONMode = *jsonFlag && !*tuiFlag
+	if !IsJSONMode {
+		fmt.Println(scorpionBanner)
+	}
+
 	if *helpFlag {
 		printHelp()
 		return
@@ -96,24 +104,56 @@ func launch_corresponding_func(pathOfFile string, clearFlag bool) {
 	ext := strings.ToLower(path.Ext(pathOfFile))
 	handler, ok := imageHandlers[ext]
 	if !ok {
+		if IsJSONMode {
+			PrintJSON(JSONResult{File: pathOfFile, Error: "Format not supported"})
+			return
+		}
 		fmt.Println("Format not supported")
 		return
 	}
 
-	if !IsTUIMode {
+	if !IsTUIMode && !IsJSONMode {
 		fmt.Println(pathOfFile)
 	}
 
 	if clearFlag {
 		handler.clear(pathOfFile)
 	} else {
-		_, err := handler.display(pathOfFile)
-		if err != nil {
+		tags, err := handler.display(pathOfFile)
+		if IsJSONMode {
+			printJSONTags(pathOfFile, tags, err)
+		} else if err != nil {
 			PrintError(fmt.Sprintf("%v", err))
 		}
 	}
 }
 
+// ce que -json ecrit pour chaque fichier
+type JSONResult struct {
+	File  string            `json:"file"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	GPS   *JSONGPS          `json:"gps,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+type JSONGPS struct {
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	OpenStreetMap string  `json:"openstreetmap"`
+}
+
+func printJSONTags(pathOfFile string, tags map[string]string, err error) {
+	result := JSONResult{File: pathOfFile, Tags: tags}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	// je donne direct les coordonnees en decimal comme ca pas besoin de reparser les rationnels
+	if gps := extractGPSCoordinates(tags); gps.HasLocation {
+		result.GPS = &JSONGPS{gps.Latitude, gps.Longitude, getOpenStreetMapURL(gps)}
+	}
+	PrintJSON(result)
+}
+
 func runTUI() {
 	// reader pour lire les entree user
 	reader := bufio.NewReader(os.Stdin)
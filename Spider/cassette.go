@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cassette is one recorded HTTP exchange. Transport errors are recorded too
+// so that a replayed crawl fails exactly where the original one did.
+type cassette struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Date       time.Time   `json:"date"`
+	Error      string      `json:"error,omitempty"`
+	Proto      string      `json:"proto,omitempty"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Status     string      `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+}
+
+func cassettePath(dir string, method string, rawURL string) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL))
+	return filepath.Join(dir, hex.EncodeToString(sum[:12])+".json")
+}
+
+// recordTransport saves every exchange going through next in dir.
+type recordTransport struct {
+	next http.RoundTripper
+	dir  string
+}
+
+func newRecordTransport(next http.RoundTripper, dir string) (*recordTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &recordTransport{next: next, dir: dir}, nil
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := cassette{Method: req.Method, URL: req.URL.String(), Date: time.Now().UTC()}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		c.Error = err.Error()
+		t.save(&c)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		c.Error = err.Error()
+		t.save(&c)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c.Proto = resp.Proto
+	c.StatusCode = resp.StatusCode
+	c.Status = resp.Status
+	c.Header = resp.Header
+	c.Body = body
+	t.save(&c)
+	return resp, nil
+}
+
+func (t *recordTransport) save(c *cassette) {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		log.Printf("RECORD: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(cassettePath(t.dir, c.Method, c.URL), content, 0644); err != nil {
+		log.Printf("RECORD: %v\n", err)
+	}
+}
+
+// replayTransport serves exchanges previously saved by recordTransport and
+// never touches the network.
+type replayTransport struct {
+	dir string
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + ": not a directory")
+	}
+	return &replayTransport{dir: dir}, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	content, err := os.ReadFile(cassettePath(t.dir, req.Method, req.URL.String()))
+	if err != nil {
+		return nil, fmt.Errorf("replay: no recorded exchange for %s %s", req.Method, req.URL)
+	}
+	var c cassette
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("replay: %s %s: %w", req.Method, req.URL, err)
+	}
+	if c.Error != "" {
+		return nil, errors.New(c.Error)
+	}
+
+	resp := &http.Response{
+		Proto:         c.Proto,
+		StatusCode:    c.StatusCode,
+		Status:        c.Status,
+		Header:        c.Header,
+		ContentLength: int64(len(c.Body)),
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(c.Proto)
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	return resp, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testPNG is a small PNG whose pixels depend on shade, so that two shades
+// give two different files.
+func testPNG(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			img.SetGray(x, y, color.Gray{Y: shade + uint8(x*y)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testSite serves the given paths, typed by their extension, PNG when they
+// have none.
+func testSite(t *testing.T, files map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveTestFile(w, r, files)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func serveTestFile(w http.ResponseWriter, r *http.Request, files map[string][]byte) {
+	content, ok := files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(r.URL.Path))
+	switch {
+	case r.URL.Path == "/":
+		contentType = "text/html; charset=utf-8"
+	case contentType == "":
+		contentType = "image/png"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(content)
+}
+
+// newTestSpider is a spider set up as main does with the default options,
+// recursive.
+func newTestSpider(t *testing.T) *Spider {
+	t.Helper()
+	valid_ext, err := acceptedExtensions(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Spider{rFlag: true, lFlag: 3, valid_ext: valid_ext}
+}
+
+// crawlTestSeed crawls seed into dir, with the state reset as for each crawl
+// of main. The trap limits set are kept.
+func crawlTestSeed(t *testing.T, spider *Spider, seed string, dir string) {
+	t.Helper()
+	spider.seen_hash = make(map[string]string)
+	spider.image_links = make(map[string]bool)
+	limits := spider.traps
+	spider.traps = newTrapGuard()
+	if limits != nil {
+		spider.traps.maxUrlLength = limits.maxUrlLength
+		spider.traps.maxPathDepth = limits.maxPathDepth
+		spider.traps.maxRepeats = limits.maxRepeats
+		spider.traps.maxQueryVariants = limits.maxQueryVariants
+		spider.traps.patternBudget = limits.patternBudget
+	}
+	spider.progress = newProgress(progressOff, 0, nil)
+	seeds := prepareSeeds([]string{seed}, dir, "")
+	if len(seeds) != 1 {
+		t.Fatalf("invalid seed %s", seed)
+	}
+	if err := crawlSeed(spider, seeds[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testCrawl crawls seed into dir after configure has set the options of the
+// test, and returns the manifest with the files relative to dir.
+func testCrawl(t *testing.T, seed string, dir string, configure func(*Spider)) []ManifestEntry {
+	t.Helper()
+	spider := newTestSpider(t)
+	manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+	var err error
+	spider.manifest, err = newManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(spider)
+	}
+	crawlTestSeed(t, spider, seed, dir)
+	spider.manifest.Close()
+	return readTestManifest(t, manifestPath, dir)
+}
+
+// readTestManifest reads a manifest, with the files relative to dir.
+func readTestManifest(t *testing.T, manifestPath string, dir string) []ManifestEntry {
+	t.Helper()
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.File != "" {
+			if entry.File, err = filepath.Rel(dir, entry.File); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if entry.DuplicateOf != "" {
+			if entry.DuplicateOf, err = filepath.Rel(dir, entry.DuplicateOf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecordReplay(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/":          []byte(`<html><body><img src="/a.png"><a href="/page.html">next</a><img src="/missing.png"></body></html>`),
+		"/page.html": []byte(`<html><body><img src="/b.png"><img src="/a.png"><a href="/gone.html">gone</a></body></html>`),
+		"/a.png":     testPNG(t, 0),
+		"/b.png":     testPNG(t, 100),
+	})
+	cassettes := t.TempDir()
+
+	recorded := testCrawl(t, server.URL+"/", t.TempDir(), func(spider *Spider) {
+		spider.recordDir = cassettes
+	})
+	if len(recorded) == 0 {
+		t.Fatal("nothing recorded")
+	}
+	saved := 0
+	for _, entry := range recorded {
+		if entry.Status == statusSaved {
+			saved++
+		}
+	}
+	if saved != 2 {
+		t.Errorf("%d image(s) saved while recording, want 2: %+v", saved, recorded)
+	}
+
+	// the replay must not need the server
+	server.Close()
+	replayed := testCrawl(t, server.URL+"/", t.TempDir(), func(spider *Spider) {
+		spider.replayDir = cassettes
+	})
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("replayed manifest differs\nrecorded: %+v\nreplayed: %+v", recorded, replayed)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+
+	"golang.org/x/net/html/charset"
+)
+
+// the encoding of a page is looked for in its first 1024 bytes, like
+// browsers do
+const charsetPrescan = 1024
+
+var htmlMediaTypes = []string{"text/html", "application/xhtml+xml"}
+
+// genericMediaTypes say nothing about the content, it is sniffed instead.
+var genericMediaTypes = []string{"", "application/octet-stream", "text/plain"}
+
+// htmlBody checks that a response is an HTML page and returns its body
+// transcoded to UTF-8. The encoding comes from the BOM, the Content-Type
+// header or the <meta charset> of the page, in that order. ok is false for
+// PDFs, images and other non HTML responses, mediaType telling what they are.
+func htmlBody(resp *http.Response) (body io.Reader, mediaType string, ok bool) {
+	reader := bufio.NewReaderSize(resp.Body, charsetPrescan)
+	head, _ := reader.Peek(charsetPrescan)
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ = mime.ParseMediaType(contentType)
+	if slices.Contains(genericMediaTypes, mediaType) {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	if !slices.Contains(htmlMediaTypes, mediaType) {
+		return nil, mediaType, false
+	}
+
+	encoding, _, _ := charset.DetermineEncoding(head, contentType)
+	return encoding.NewDecoder().Reader(reader), mediaType, true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNonUTF8Pages(t *testing.T) {
+	// "café" in ISO-8859-1 and in UTF-8
+	latin1, utf8 := "caf\xe9", "café"
+	pages := map[string]struct {
+		contentType string
+		body        string
+	}{
+		"/header":     {"text/html; charset=iso-8859-1", `<html><body><img src="/` + latin1 + `.png"></body></html>`},
+		"/meta":       {"text/html", `<html><head><meta charset="iso-8859-1"></head><body><img src="/` + latin1 + `.png"></body></html>`},
+		"/http-equiv": {"text/html", `<html><head><meta http-equiv="Content-Type" content="text/html; charset=windows-1252"></head><body><img src="/` + latin1 + `.png"></body></html>`},
+		"/bom":        {"text/html; charset=iso-8859-1", "\xef\xbb\xbf" + `<html><body><img src="/` + utf8 + `.png"></body></html>`},
+		"/sniffed":    {"application/octet-stream", `<html><head><meta charset="iso-8859-1"></head><body><img src="/` + latin1 + `.png"></body></html>`},
+		"/pdf":        {"application/pdf", "%PDF-1.4 <img src=\"/" + utf8 + ".png\">"},
+	}
+	image := testPNG(t, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+utf8+".png" {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(image)
+			return
+		}
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", page.contentType)
+		w.Write([]byte(page.body))
+	}))
+	defer server.Close()
+
+	for pagePath := range pages {
+		t.Run(strings.TrimPrefix(pagePath, "/"), func(t *testing.T) {
+			dir := t.TempDir()
+			entries := testCrawl(t, server.URL+pagePath, dir, nil)
+			if pagePath == "/pdf" {
+				if len(entries) != 0 {
+					t.Errorf("manifest %+v, want nothing from a PDF", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("manifest %+v, want the image of the page", entries)
+			}
+			if entry := entries[0]; entry.Status != statusSaved || entry.File != utf8+".png" {
+				t.Errorf("manifest entry %+v, want %s saved", entry, filepath.Join(dir, utf8+".png"))
+			}
+		})
+	}
+}
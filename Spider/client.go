@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+func newHttpClient(spider *Spider) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if spider.localRoot != "" {
+		transport.RegisterProtocol("file", localTransport{http.NewFileTransport(http.Dir(spider.localRoot))})
+	}
+
+	var rt http.RoundTripper = transport
+	if spider.throttle != nil {
+		rt = &throttleTransport{next: rt, throttle: spider.throttle}
+	}
+	if spider.har != nil {
+		rt = spider.har
+	}
+	if spider.replayDir != "" {
+		replay, err := newReplayTransport(spider.replayDir)
+		if err != nil {
+			return nil, err
+		}
+		rt = replay
+	}
+	if spider.recordDir != "" {
+		record, err := newRecordTransport(rt, spider.recordDir)
+		if err != nil {
+			return nil, err
+		}
+		rt = record
+	}
+	if spider.warc != nil {
+		// keep bodies exactly as the server sent them in the archive
+		transport.DisableCompression = true
+		rt = &warcTransport{next: rt, warc: spider.warc}
+	}
+	if spider.evidence != nil {
+		rt = &evidenceTransport{next: rt, evidence: spider.evidence}
+	}
+	if spider.delay > 0 {
+		rt = &delayTransport{next: rt, delay: spider.delay}
+	}
+	if spider.userAgent != "" {
+		rt = userAgentTransport{next: rt, userAgent: spider.userAgent}
+	}
+	return &http.Client{Transport: rt, Timeout: spider.timeout}, nil
+}
+
+// userAgentTransport sends the -user-agent of the spider with every request.
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+// delayTransport waits -delay between two http(s) requests.
+type delayTransport struct {
+	next  http.RoundTripper
+	delay time.Duration
+	mu    sync.Mutex
+	last  time.Time
+}
+
+func (t *delayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" || req.URL.Scheme == "https" {
+		t.mu.Lock()
+		time.Sleep(time.Until(t.last.Add(t.delay)))
+		t.last = time.Now()
+		t.mu.Unlock()
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configOnlyFlags are not part of a configuration.
+var configOnlyFlags = []string{"h", "config", "print-config"}
+
+// loadConfig sets the flags not given on the command line from a JSON file
+// whose keys are flag names, like {"r": true, "l": 3, "formats": ["jpeg"]}.
+// Objects group flags in sections, {"filters": {"min-width": 200}}, and
+// "urls" lists seeds. It returns these seeds.
+func loadConfig(configPath string) ([]string, error) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]any
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", configPath, err)
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var urls []string
+	var apply func(values map[string]any, section string) error
+	apply = func(values map[string]any, section string) error {
+		for name, value := range values {
+			if name == "urls" {
+				list, ok := value.([]any)
+				if !ok {
+					return fmt.Errorf("%s: urls must be a list", configPath)
+				}
+				for _, u := range list {
+					urls = append(urls, fmt.Sprint(u))
+				}
+				continue
+			}
+			if sectionValues, ok := value.(map[string]any); ok && section == "" {
+				if err := apply(sectionValues, name); err != nil {
+					return err
+				}
+				continue
+			}
+			if flag.Lookup(name) == nil || slices.Contains(configOnlyFlags, name) {
+				return fmt.Errorf("%s: unknown option %q", configPath, strings.TrimPrefix(section+"."+name, "."))
+			}
+			if given[name] {
+				continue
+			}
+			if err := flag.Set(name, configValue(value)); err != nil {
+				return fmt.Errorf("%s: %s: %v", configPath, name, err)
+			}
+		}
+		return nil
+	}
+	if err := apply(config, ""); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func configValue(value any) string {
+	switch v := value.(type) {
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = configValue(item)
+		}
+		return strings.Join(items, ",")
+	case float64:
+		// fmt would write the large sizes as 1e+06
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// printConfig prints the merged configuration, in the format of -config.
+func printConfig(urls []string) error {
+	config := map[string]any{"urls": urls}
+	if urls == nil {
+		config["urls"] = []string{}
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if slices.Contains(configOnlyFlags, f.Name) {
+			return
+		}
+		value := f.Value.(flag.Getter).Get()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		config[f.Name] = value
+	})
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testFlags replaces the flags of the command line by a few of spider,
+// parsed from args, for the duration of the test.
+func testFlags(t *testing.T, args ...string) (r *bool, l *int, p *string, minWidth *int, formats *string, timeout *time.Duration) {
+	t.Helper()
+	commandLine := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = commandLine })
+	flag.CommandLine = flag.NewFlagSet("spider", flag.ContinueOnError)
+	r = flag.Bool("r", false, "")
+	l = flag.Int("l", 5, "")
+	p = flag.String("p", "./data/", "")
+	minWidth = flag.Int("min-width", 0, "")
+	formats = flag.String("formats", "", "")
+	timeout = flag.Duration("timeout", 10*time.Second, "")
+	flag.String("config", "", "")
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "spider.json")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	r, l, p, minWidth, formats, timeout := testFlags(t, "-l", "5", "-formats", "png", "https://cli.example/")
+	configPath := writeTestConfig(t, `{
+		"r": true,
+		"l": 4,
+		"p": "./from-config/",
+		"timeout": "3s",
+		"filters": {"min-width": 200, "formats": ["jpeg", "gif"]},
+		"urls": ["https://a.example/", "https://b.example/"]
+	}`)
+	urls, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the flags of the command line win, even when given their default
+	if *l != 5 || *formats != "png" {
+		t.Errorf("-l %d -formats %q, want the ones of the command line, 5 and png", *l, *formats)
+	}
+	if !*r || *p != "./from-config/" || *minWidth != 200 || *timeout != 3*time.Second {
+		t.Errorf("-r %v -p %q -min-width %d -timeout %s, want the ones of the config", *r, *p, *minWidth, *timeout)
+	}
+	if want := []string{"https://a.example/", "https://b.example/"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("config urls = %q, want %q", urls, want)
+	}
+	if args := flag.Args(); !reflect.DeepEqual(args, []string{"https://cli.example/"}) {
+		t.Errorf("seeds of the command line = %q, want them untouched", args)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, config, want string
+	}{
+		{"unknown option", `{"bogus": 1}`, `unknown option "bogus"`},
+		{"unknown option in a section", `{"filters": {"bogus": 1}}`, `unknown option "filters.bogus"`},
+		{"option of the command line only", `{"config": "other.json"}`, `unknown option "config"`},
+		{"invalid value", `{"l": "deep"}`, `l: parse error`},
+		{"urls not a list", `{"urls": "https://a.example/"}`, `urls must be a list`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testFlags(t)
+			configPath := writeTestConfig(t, test.config)
+			_, err := loadConfig(configPath)
+			if err == nil || err.Error() != configPath+": "+test.want {
+				t.Errorf("loadConfig error %v, want %s: %s", err, configPath, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	eventPageFetched  = "page_fetched"
+	eventImageSaved   = "image_saved"
+	eventImageSkipped = "image_skipped"
+	eventError        = "error"
+	eventSummary      = "summary"
+	eventWatchDiff    = "watch_diff"
+)
+
+type pageEvent struct {
+	Event       string `json:"event"`
+	Time        string `json:"time"`
+	URL         string `json:"url"`
+	Depth       int    `json:"depth"`
+	HTTPStatus  int    `json:"http_status"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// imageEvent carries the manifest entry of the image, its status tells why
+// a skipped image was skipped.
+type imageEvent struct {
+	Event string `json:"event"`
+	Time  string `json:"time"`
+	ManifestEntry
+}
+
+type errorEvent struct {
+	Event  string `json:"event"`
+	Time   string `json:"time"`
+	Kind   string `json:"kind"`
+	URL    string `json:"url"`
+	Page   string `json:"page,omitempty"`
+	Class  string `json:"class"`
+	Reason string `json:"reason"`
+}
+
+type seedSummary struct {
+	Seed       string `json:"seed"`
+	Directory  string `json:"directory"`
+	Pages      int    `json:"pages"`
+	Saved      int    `json:"saved"`
+	Duplicates int    `json:"duplicates"`
+	Rejected   int    `json:"rejected"`
+	Errors     int    `json:"errors"`
+}
+
+type depthSummary struct {
+	Depth  int `json:"depth"`
+	Pages  int `json:"pages"`
+	Images int `json:"images"`
+}
+
+type errorSummary struct {
+	Class string `json:"class"`
+	Cause string `json:"cause"`
+	Count int    `json:"count"`
+}
+
+type summaryEvent struct {
+	Event         string         `json:"event"`
+	Time          string         `json:"time"`
+	DurationMs    int64          `json:"duration_ms"`
+	PagesFetched  int            `json:"pages_fetched"`
+	ImagesSaved   int            `json:"images_saved"`
+	ImagesSkipped int            `json:"images_skipped"`
+	ImagesFailed  int            `json:"images_failed"`
+	Bytes         int64          `json:"bytes"`
+	Seeds         []seedSummary  `json:"seeds"`
+	Depths        []depthSummary `json:"depths"`
+	Errors        []errorSummary `json:"errors"`
+}
+
+// Events writes one JSON object per line for each thing the crawl does.
+// A nil *Events writes nothing.
+type Events struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEvents(w io.Writer) *Events {
+	return &Events{enc: json.NewEncoder(w)}
+}
+
+func eventTime() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func (e *Events) emit(v any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(v)
+}
+
+func (e *Events) PageFetched(pageUrl string, depth int, status int, contentType string) {
+	if e == nil {
+		return
+	}
+	e.emit(pageEvent{eventPageFetched, eventTime(), pageUrl, depth, status, contentType})
+}
+
+func (e *Events) PageError(pageUrl string, reason string) {
+	if e == nil {
+		return
+	}
+	e.emit(errorEvent{eventError, eventTime(), "page", pageUrl, "", errorClass(reason), reason})
+}
+
+func (e *Events) Image(entry ManifestEntry) {
+	if e == nil {
+		return
+	}
+	switch entry.Status {
+	case statusSaved:
+		e.emit(imageEvent{eventImageSaved, eventTime(), entry})
+	case statusError:
+		e.emit(errorEvent{eventError, eventTime(), "image", entry.URL, entry.Page, errorClass(entry.Reason), entry.Reason})
+	default:
+		e.emit(imageEvent{eventImageSkipped, eventTime(), entry})
+	}
+}
+
+func (e *Events) Summary(seeds []*Seed, progress *Progress) {
+	if e == nil {
+		return
+	}
+	summary := progress.Summary()
+	summary.Event = eventSummary
+	summary.Time = eventTime()
+	for _, seed := range seeds {
+		s := seed.stats
+		summary.Seeds = append(summary.Seeds, seedSummary{seed.arg, seed.dir, s.pages, s.saved, s.duplicates, s.rejected, s.errors})
+	}
+	e.emit(summary)
+}
+
+func (e *Events) WatchDiff(diff *WatchDiff) {
+	if e == nil {
+		return
+	}
+	e.emit(diff)
+}
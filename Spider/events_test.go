@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/":          []byte(`<html><body><img src="/a.png"><img src="/copy.png"><img src="/gone.png"><a href="/page.html">page</a><a href="/missing.html">gone</a></body></html>`),
+		"/page.html": []byte(`<html><body><img src="/b.png"></body></html>`),
+		"/a.png":     testPNG(t, 1),
+		"/copy.png":  testPNG(t, 1),
+		"/b.png":     testPNG(t, 2),
+	})
+	var out bytes.Buffer
+	spider := newTestSpider(t)
+	spider.events = newEvents(&out)
+	seeds := prepareSeeds([]string{server.URL + "/"}, t.TempDir(), "")
+	spider.seen_hash = make(map[string]string)
+	spider.image_links = make(map[string]bool)
+	spider.traps = newTrapGuard()
+	spider.progress = newProgress(progressOff, 0, nil)
+	if err := spider.progress.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := crawlSeed(spider, seeds[0]); err != nil {
+		t.Fatal(err)
+	}
+	spider.progress.Stop()
+	spider.events.Summary(seeds, spider.progress)
+
+	// each event by its kind, its URL and its status or error class
+	var got []string
+	var summary summaryEvent
+	for line := range strings.Lines(out.String()) {
+		var event struct {
+			Event  string `json:"event"`
+			Time   string `json:"time"`
+			URL    string `json:"url"`
+			Status string `json:"status"`
+			Class  string `json:"class"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%v in event %s", err, line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, event.Time); err != nil {
+			t.Errorf("event %s: %v", line, err)
+		}
+		if event.Event == eventSummary {
+			if err := json.Unmarshal([]byte(line), &summary); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got = append(got, strings.Join([]string{event.Event, strings.TrimPrefix(event.URL, server.URL), event.Status + event.Class}, " "))
+	}
+	want := []string{
+		"page_fetched / ",
+		"image_saved /a.png saved",
+		"image_skipped /copy.png duplicate",
+		"error /gone.png http-4xx",
+		"page_fetched /page.html ",
+		"image_saved /b.png saved",
+		"page_fetched /missing.html ",
+		"error /missing.html http-4xx",
+		"summary  ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if summary.PagesFetched != 2 || summary.ImagesSaved != 2 || summary.ImagesSkipped != 1 || summary.ImagesFailed != 1 {
+		t.Errorf("summary: %d pages, %d saved, %d skipped, %d failed, want 2, 2, 1, 1",
+			summary.PagesFetched, summary.ImagesSaved, summary.ImagesSkipped, summary.ImagesFailed)
+	}
+	wantSeeds := []seedSummary{{seeds[0].arg, seeds[0].dir, 2, 2, 1, 0, 1}}
+	if !reflect.DeepEqual(summary.Seeds, wantSeeds) {
+		t.Errorf("summary seeds = %+v, want %+v", summary.Seeds, wantSeeds)
+	}
+	wantErrors := []errorSummary{{"http-4xx", "bad status: 404 Not Found", 2}}
+	if !reflect.DeepEqual(summary.Errors, wantErrors) {
+		t.Errorf("summary errors = %+v, want %+v", summary.Errors, wantErrors)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	evidenceManifestName = "evidence.jsonl"
+	evidenceSignatureExt = ".sig"
+
+	evidenceExchange = "exchange"
+	evidenceFile     = "file"
+	evidenceRemoved  = "removed"
+)
+
+// EvidenceRecord is one line of the evidence manifest. An exchange record
+// tells where a response came from and what it contained, a file record
+// which file of the output directory holds which content, and a removed
+// record that a file was deleted by the crawl itself (-near-dup).
+type EvidenceRecord struct {
+	Kind          string      `json:"kind"`
+	Time          string      `json:"time"`
+	Method        string      `json:"method,omitempty"`
+	URL           string      `json:"url"`
+	Page          string      `json:"page,omitempty"`
+	IP            string      `json:"ip,omitempty"`
+	TLSCertSHA256 string      `json:"tls_cert_sha256,omitempty"`
+	Status        int         `json:"status,omitempty"`
+	Header        http.Header `json:"header,omitempty"`
+	File          string      `json:"file,omitempty"`
+	SHA256        string      `json:"sha256,omitempty"`
+	Size          int64       `json:"size"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// evidenceSignature is written next to the manifest. The signature is the
+// Ed25519 signature of the manifest file, as it is on disk.
+type evidenceSignature struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	SHA256    string `json:"sha256"`
+	Records   int    `json:"records"`
+	SignedAt  string `json:"signed_at"`
+	Signature string `json:"signature"`
+}
+
+// signedPayload is what the signature covers: the hash of the manifest, its
+// number of records and the time of the signature, so that none of them can
+// be changed without the signature failing.
+func (s *evidenceSignature) signedPayload() []byte {
+	return fmt.Appendf(nil, "spider-evidence\nsha256:%s\nrecords:%d\nsigned_at:%s\n", s.SHA256, s.Records, s.SignedAt)
+}
+
+// Evidence writes the chain of custody of a crawl in <-p>/evidence.jsonl and
+// signs it. A nil *Evidence records nothing.
+type Evidence struct {
+	mu      sync.Mutex
+	root    string
+	path    string
+	file    *os.File
+	enc     *json.Encoder
+	key     ed25519.PrivateKey
+	records int
+	// files saved by content, to find the ones removed by -near-dup
+	files map[string]string
+}
+
+func newEvidence(keyPath string, root string) (*Evidence, error) {
+	key, err := readEd25519PrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(root, evidenceManifestName)
+	f, err := os.Create(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Evidence{
+		root:  root,
+		path:  manifestPath,
+		file:  f,
+		enc:   json.NewEncoder(f),
+		key:   key,
+		files: make(map[string]string),
+	}, nil
+}
+
+func readPEM(keyPath string) (*pem.Block, error) {
+	content, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key found", keyPath)
+	}
+	return block, nil
+}
+
+// readEd25519PrivateKey reads a PKCS#8 PEM key, like the ones written by
+// openssl genpkey -algorithm ed25519.
+func readEd25519PrivateKey(keyPath string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyPath, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", keyPath)
+	}
+	return private, nil
+}
+
+// readEd25519PublicKey reads a PKIX PEM public key, or takes the public
+// part of a private key.
+func readEd25519PublicKey(keyPath string) (ed25519.PublicKey, error) {
+	block, err := readPEM(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		private, err := readEd25519PrivateKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		return private.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyPath, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", keyPath)
+	}
+	return public, nil
+}
+
+func (e *Evidence) add(record EvidenceRecord) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.enc.Encode(record); err != nil {
+		fmt.Println("EVIDENCE:", err)
+		return
+	}
+	e.records++
+}
+
+// relative gives the path of a file from the output directory, so that the
+// directory can be verified after being moved.
+func (e *Evidence) relative(file string) string {
+	if rel, err := filepath.Rel(e.root, file); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// Image records the files saved, and the ones removed by -near-dup.
+func (e *Evidence) Image(entry ManifestEntry) {
+	if e == nil {
+		return
+	}
+	record := EvidenceRecord{Time: eventTime(), URL: entry.URL, Page: entry.Page, SHA256: entry.SHA256, Size: entry.Size}
+	switch {
+	case entry.Status == statusSaved:
+		record.Kind = evidenceFile
+		record.File = e.relative(entry.File)
+		e.mu.Lock()
+		e.files[entry.SHA256] = record.File
+		e.mu.Unlock()
+	case entry.Status == statusNearDuplicate && entry.File == "":
+		record.Kind = evidenceRemoved
+		e.mu.Lock()
+		record.File = e.files[entry.SHA256]
+		e.mu.Unlock()
+		record.Error = entry.Reason
+	default:
+		return
+	}
+	e.add(record)
+}
+
+// Sign writes the signature of the manifest as it is now. It is called after
+// every crawl, so a watch keeps a valid signature between two crawls.
+func (e *Evidence) Sign() error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	content, err := os.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	signature := evidenceSignature{
+		Algorithm: "ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(e.key.Public().(ed25519.PublicKey)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Records:   e.records,
+		SignedAt:  eventTime(),
+	}
+	signature.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(e.key, signature.signedPayload()))
+	encoded, err := json.MarshalIndent(signature, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.path+evidenceSignatureExt, encoded, 0644)
+}
+
+func (e *Evidence) Close() error {
+	if e == nil {
+		return nil
+	}
+	return e.file.Close()
+}
+
+// evidenceTransport records every exchange going through the client: the
+// address of the server, its certificate and the hash of the body.
+type evidenceTransport struct {
+	next     http.RoundTripper
+	evidence *Evidence
+}
+
+func (t *evidenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	record := EvidenceRecord{Kind: evidenceExchange, Time: eventTime(), Method: req.Method, URL: req.URL.String()}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				record.IP = host
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		record.Error = err.Error()
+		t.evidence.add(record)
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		record.Error = err.Error()
+		t.evidence.add(record)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.Sum256(body)
+	record.SHA256 = hex.EncodeToString(sum[:])
+	record.Size = int64(len(body))
+	record.Status = resp.StatusCode
+	record.Header = resp.Header
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := sha256.Sum256(resp.TLS.PeerCertificates[0].Raw)
+		record.TLSCertSHA256 = hex.EncodeToString(cert[:])
+	}
+	t.evidence.add(record)
+	return resp, nil
+}
+
+// verifyCommand checks a directory against its signed evidence manifest:
+// the signature first, then the hash of every file listed. It returns the
+// exit code of spider verify.
+func verifyCommand(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyFlag := flags.String("key", "", "Ed25519 public key (PEM) expected to have signed the manifest")
+	flags.Usage = func() {
+		fmt.Println("USAGE:\n  spider verify [-key PUBLIC_KEY.pem] DIRECTORY")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	root := flags.Arg(0)
+	manifestPath := filepath.Join(root, evidenceManifestName)
+
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	encoded, err := os.ReadFile(manifestPath + evidenceSignatureExt)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	var signature evidenceSignature
+	if err := json.Unmarshal(encoded, &signature); err != nil {
+		fmt.Printf("%s%s: %v\n", manifestPath, evidenceSignatureExt, err)
+		return 1
+	}
+	public, err := base64.StdEncoding.DecodeString(signature.PublicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		fmt.Println("SIGNATURE: invalid public key")
+		return 1
+	}
+	if *keyFlag != "" {
+		expected, err := readEd25519PublicKey(*keyFlag)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if !expected.Equal(ed25519.PublicKey(public)) {
+			fmt.Println("SIGNATURE: FAILED, the manifest is signed by another key")
+			return 1
+		}
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil || !ed25519.Verify(public, signature.signedPayload(), sig) {
+		fmt.Println("SIGNATURE: FAILED, the signature file was modified after being signed")
+		return 1
+	}
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	if len(content) == 0 {
+		lines = nil
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != signature.SHA256 || len(lines) != signature.Records {
+		fmt.Println("SIGNATURE: FAILED, the manifest was modified after being signed")
+		return 1
+	}
+	keySum := sha256.Sum256(public)
+	fmt.Printf("SIGNATURE: ok, %d record(s) signed at %s by key SHA256:%s\n", signature.Records, signature.SignedAt, hex.EncodeToString(keySum[:]))
+	if *keyFlag == "" {
+		fmt.Println("SIGNATURE: no -key given, the key is the one stored with the manifest")
+	}
+
+	// the last record of a file wins: a watch saves the same files again
+	expected := make(map[string]string)
+	for i, line := range lines {
+		var record EvidenceRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			fmt.Printf("%s:%d: %v\n", manifestPath, i+1, err)
+			return 1
+		}
+		switch record.Kind {
+		case evidenceFile:
+			expected[record.File] = record.SHA256
+		case evidenceRemoved:
+			delete(expected, record.File)
+		}
+	}
+
+	var ok, modified, missing, unlisted int
+	for _, file := range sortedKeys(expected) {
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			fmt.Println("MISSING:", file)
+			missing++
+			continue
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil || hex.EncodeToString(hash.Sum(nil)) != expected[file] {
+			fmt.Println("MODIFIED:", file)
+			modified++
+			continue
+		}
+		ok++
+	}
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if _, listed := expected[rel]; listed || strings.HasPrefix(rel, evidenceManifestName) || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		fmt.Println("UNLISTED:", rel)
+		unlisted++
+		return nil
+	})
+
+	fmt.Printf("VERIFY: %d file(s) ok, %d modified, %d missing, %d not in the manifest\n", ok, modified, missing, unlisted)
+	if modified > 0 || missing > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestKeys writes a PKCS#8 private key and its PKIX public key, as
+// openssl genpkey and openssl pkey -pubout do.
+func writeTestKeys(t *testing.T) (string, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	privatePath, publicPath := filepath.Join(dir, "key.pem"), filepath.Join(dir, "public.pem")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestVerifyCommand(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/":      []byte(`<img src="/a.png"><img src="/b.png">`),
+		"/a.png": testPNG(t, 0),
+		"/b.png": testPNG(t, 100),
+	})
+	privatePath, publicPath := writeTestKeys(t)
+	_, otherPublicPath := writeTestKeys(t)
+
+	// crawl returns a signed directory
+	crawl := func() string {
+		dir := t.TempDir()
+		evidence, err := newEvidence(privatePath, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer evidence.Close()
+		testCrawl(t, server.URL+"/", dir, func(spider *Spider) {
+			spider.evidence = evidence
+		})
+		if err := evidence.Sign(); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	sign := func(t *testing.T, dir string, change func(*evidenceSignature)) {
+		sigPath := filepath.Join(dir, evidenceManifestName+evidenceSignatureExt)
+		content, err := os.ReadFile(sigPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var signature evidenceSignature
+		if err := json.Unmarshal(content, &signature); err != nil {
+			t.Fatal(err)
+		}
+		change(&signature)
+		content, _ = json.Marshal(signature)
+		if err := os.WriteFile(sigPath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		tamper func(t *testing.T, dir string)
+		want   int
+	}{
+		{name: "intact", key: publicPath, want: 0},
+		{name: "no key", want: 0},
+		{name: "private key", key: privatePath, want: 0},
+		{name: "other key", key: otherPublicPath, want: 1},
+		{name: "unlisted file", key: publicPath, want: 0, tamper: func(t *testing.T, dir string) {
+			os.WriteFile(filepath.Join(dir, "added.png"), testPNG(t, 7), 0644)
+		}},
+		{name: "modified file", key: publicPath, want: 1, tamper: func(t *testing.T, dir string) {
+			os.WriteFile(filepath.Join(dir, "a.png"), testPNG(t, 7), 0644)
+		}},
+		{name: "missing file", key: publicPath, want: 1, tamper: func(t *testing.T, dir string) {
+			os.Remove(filepath.Join(dir, "b.png"))
+		}},
+		{name: "modified manifest", key: publicPath, want: 1, tamper: func(t *testing.T, dir string) {
+			f, _ := os.OpenFile(filepath.Join(dir, evidenceManifestName), os.O_APPEND|os.O_WRONLY, 0644)
+			f.WriteString(`{"kind":"file","file":"added.png"}` + "\n")
+			f.Close()
+		}},
+		{name: "modified time", key: publicPath, want: 1, tamper: func(t *testing.T, dir string) {
+			sign(t, dir, func(s *evidenceSignature) { s.SignedAt = "2000-01-01T00:00:00Z" })
+		}},
+		{name: "modified records", key: publicPath, want: 1, tamper: func(t *testing.T, dir string) {
+			sign(t, dir, func(s *evidenceSignature) { s.Records++ })
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := crawl()
+			if test.tamper != nil {
+				test.tamper(t, dir)
+			}
+			args := []string{dir}
+			if test.key != "" {
+				args = []string{"-key", test.key, dir}
+			}
+			if got := verifyCommand(args); got != test.want {
+				t.Errorf("verifyCommand() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	candidateImage = "image"
+	candidateLink  = "link"
+	// a JSON endpoint named by a script, fetched like a link for the
+	// images it names
+	candidateEndpoint = "endpoint"
+)
+
+// Candidate is an image, a link or a JSON endpoint found in a page, with
+// where it was found.
+type Candidate struct {
+	Kind      string
+	URL       string // absolute URL or data: URI
+	Page      string
+	Source    string // img, srcset, css, og:image, a, ...
+	Thumbnail string
+	// Typed images are known to be images from their context (metadata,
+	// HEAD request), they need no image extension.
+	Typed bool
+	// Content holds the images having no URL of their own, like inline <svg>.
+	Content []byte
+}
+
+// Extractor yields the candidates of one node of a parsed page. It is called
+// for every node of every page.
+type Extractor interface {
+	Extract(node *html.Node, spider *Spider, page string) []Candidate
+}
+
+type ExtractorFunc func(node *html.Node, spider *Spider, page string) []Candidate
+
+func (f ExtractorFunc) Extract(node *html.Node, spider *Spider, page string) []Candidate {
+	return f(node, spider, page)
+}
+
+// CandidateFilter accepts a candidate, or rejects it with the reason why.
+// Rejected images go to the manifest, rejected links are not crawled. A
+// candidate rejected with no reason is dropped silently, as the <img> of
+// the pages that are not images of an accepted extension always were.
+type CandidateFilter interface {
+	Accept(spider *Spider, candidate Candidate) (bool, string)
+}
+
+type FilterFunc func(spider *Spider, candidate Candidate) (bool, string)
+
+func (f FilterFunc) Accept(spider *Spider, candidate Candidate) (bool, string) {
+	return f(spider, candidate)
+}
+
+type namedExtractor struct {
+	name      string
+	extractor Extractor
+}
+
+type namedFilter struct {
+	name   string
+	filter CandidateFilter
+}
+
+// extractors are run in order on each node, add yours with
+// registerExtractor.
+var extractors = []namedExtractor{
+	{"inline-svg", ExtractorFunc(extract_inline_svg)},
+	{"css-data-uri", ExtractorFunc(extract_css_data_uris)},
+	{"srcset-data-uri", ExtractorFunc(extract_srcset_data_uris)},
+	{"img", ExtractorFunc(extract_img_src)},
+	{"metadata", ExtractorFunc(extract_meta_images)},
+	{"script-heuristic", ExtractorFunc(extract_script_images)},
+	{"linked-images", ExtractorFunc(extract_linked_images)},
+	{"links", ExtractorFunc(extract_links)},
+}
+
+// candidateFilters must all accept a candidate, add yours with
+// registerFilter.
+var candidateFilters = []namedFilter{
+	{"extension", FilterFunc(filterImageExtension)},
+	{"traps", FilterFunc(filterTraps)},
+}
+
+func registerExtractor(name string, extractor Extractor) {
+	extractors = append(extractors, namedExtractor{name, extractor})
+}
+
+func registerFilter(name string, filter CandidateFilter) {
+	candidateFilters = append(candidateFilters, namedFilter{name, filter})
+}
+
+func acceptCandidate(spider *Spider, candidate Candidate) (bool, string) {
+	for _, f := range candidateFilters {
+		if ok, reason := f.filter.Accept(spider, candidate); !ok {
+			if reason == "" {
+				return false, ""
+			}
+			return false, fmt.Sprintf("%s: %s", f.name, reason)
+		}
+	}
+	return true, ""
+}
+
+// extract_candidates runs the extractors on a node: images are downloaded
+// and the links and endpoints to crawl next are returned.
+func extract_candidates(currentNode *html.Node, spider *Spider, page string, followLinks bool) []Candidate {
+	var links []Candidate
+	for _, e := range extractors {
+		for _, candidate := range e.extractor.Extract(currentNode, spider, page) {
+			if candidate.Page == "" {
+				candidate.Page = page
+			}
+			if handle_candidate(spider, candidate, followLinks) {
+				links = append(links, candidate)
+			}
+		}
+	}
+	return links
+}
+
+// handle_candidate downloads an image candidate, and tells if a link or an
+// endpoint candidate is to be crawled.
+func handle_candidate(spider *Spider, candidate Candidate, followLinks bool) bool {
+	ref := imageRef{url: candidate.URL, page: candidate.Page, source: candidate.Source, thumbnail: candidate.Thumbnail}
+
+	if candidate.Kind == candidateLink || candidate.Kind == candidateEndpoint {
+		spider.graph.Link(candidate.Page, candidate.URL)
+		if !followLinks || spider.visited_url[candidate.URL] {
+			return false
+		}
+		if candidate.Kind == candidateEndpoint && !spider.endpoints {
+			return false
+		}
+		spider.visited_url[candidate.URL] = true
+		ok, _ := acceptCandidate(spider, candidate)
+		return ok
+	}
+
+	if ok, reason := acceptCandidate(spider, candidate); !ok {
+		if reason != "" {
+			rejectImage(spider, ref.manifestEntry(), reason)
+		}
+		return false
+	}
+	switch {
+	case candidate.Content != nil:
+		ext := "." + normalizeFormat(sniffImage(candidate.Content).format)
+		storeImage(spider, ref, contentFileName("inline", candidate.Content, ext), bytes.NewReader(candidate.Content))
+	case isDataURI(candidate.URL):
+		download_data_uri(candidate.URL, spider, candidate.Page, candidate.Source)
+	default:
+		writeImgFile(spider, ref)
+	}
+	return false
+}
+
+// filterImageExtension silently drops the images without an accepted
+// extension. Data URIs and inline images are checked on their media type
+// when decoded.
+func filterImageExtension(spider *Spider, candidate Candidate) (bool, string) {
+	if candidate.Kind != candidateImage || candidate.Content != nil || isDataURI(candidate.URL) {
+		return true, ""
+	}
+	ext := imageExt(candidate.URL)
+	return slices.Contains(spider.valid_ext, ext) || ext == "" && candidate.Typed, ""
+}
+
+func filterTraps(spider *Spider, candidate Candidate) (bool, string) {
+	if candidate.Kind == candidateImage {
+		return true, ""
+	}
+	if trap := spider.traps.Check(candidate.URL); trap != "" {
+		return false, trap
+	}
+	return true, ""
+}
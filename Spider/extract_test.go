@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCandidatesWithoutImageExtension(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/":      []byte(`<img src="/a.png"><img src="/notes.txt"><img src="/pixel"><img src="/b.png">`),
+		"/a.png": testPNG(t, 0),
+		"/b.png": testPNG(t, 100),
+	})
+	entries := testCrawl(t, server.URL+"/", t.TempDir(), func(spider *Spider) {
+		spider.valid_ext = []string{".png"}
+	})
+	for _, entry := range entries {
+		if entry.Status != statusSaved {
+			t.Errorf("%s: %s %s, want no entry", entry.URL, entry.Status, entry.Reason)
+		}
+	}
+	if len(entries) != 2 {
+		t.Errorf("%d entries, want the 2 saved images: %+v", len(entries), entries)
+	}
+}
+
+func TestAcceptCandidate(t *testing.T) {
+	spider := &Spider{valid_ext: []string{".jpg"}, traps: newTrapGuard()}
+	spider.traps.maxUrlLength = 30
+	tests := []struct {
+		name      string
+		candidate Candidate
+		ok        bool
+		reason    string
+	}{
+		{"image", Candidate{Kind: candidateImage, URL: "http://a/b.jpg"}, true, ""},
+		{"other extension", Candidate{Kind: candidateImage, URL: "http://a/b.txt"}, false, ""},
+		{"no extension", Candidate{Kind: candidateImage, URL: "http://a/b"}, false, ""},
+		{"typed", Candidate{Kind: candidateImage, URL: "http://a/b", Typed: true}, true, ""},
+		{"data URI", Candidate{Kind: candidateImage, URL: "data:image/png;base64,AA=="}, true, ""},
+		{"link", Candidate{Kind: candidateLink, URL: "http://a/b.html"}, true, ""},
+		{"trap", Candidate{Kind: candidateLink, URL: "http://a/" + "very/long/path/to/a/page.html"}, false, "traps: url-length"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, reason := acceptCandidate(spider, test.candidate)
+			if ok != test.ok || reason != test.reason {
+				t.Errorf("acceptCandidate() = %v, %q, want %v, %q", ok, reason, test.ok, test.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// first bytes of an image read to detect its format and dimensions, enough
+// to get past the EXIF block of most JPEGs
+const sniffSize = 64 * 1024
+
+// ImageFilter rejects images from their header and size. Zero values mean
+// no limit.
+type ImageFilter struct {
+	minWidth, maxWidth   int
+	minHeight, maxHeight int
+	minSize, maxSize     int64
+	formats              []string
+	excludeFormats       []string
+	minRatio, maxRatio   float64
+}
+
+type imageHeader struct {
+	format        string
+	width, height int
+	hasDimensions bool
+}
+
+// sniffImage detects the format of an image and, when the stdlib knows the
+// format, its dimensions.
+func sniffImage(head []byte) imageHeader {
+	if config, format, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+		return imageHeader{format: format, width: config.Width, height: config.Height, hasDimensions: true}
+	}
+	if len(head) >= 26 && string(head[:2]) == "BM" {
+		width := int(int32(binary.LittleEndian.Uint32(head[18:22])))
+		height := int(int32(binary.LittleEndian.Uint32(head[22:26])))
+		if height < 0 {
+			height = -height
+		}
+		return imageHeader{format: "bmp", width: width, height: height, hasDimensions: true}
+	}
+
+	if f := formatBySignature(head); f != nil {
+		header := imageHeader{format: f.name}
+		if f.name == "webp" {
+			header.width, header.height, header.hasDimensions = webpDimensions(head)
+		}
+		return header
+	}
+	contentType := http.DetectContentType(head)
+	if format, ok := strings.CutPrefix(contentType, "image/"); ok {
+		return imageHeader{format: format}
+	}
+	return imageHeader{format: "unknown"}
+}
+
+func normalizeFormat(format string) string {
+	if f := lookupFormat(format); f != nil {
+		return f.name
+	}
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+}
+
+func parseFormatList(list string) []string {
+	var formats []string
+	for format := range strings.SplitSeq(list, ",") {
+		if format = normalizeFormat(format); format != "" {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// checkHeader returns why the image is rejected, or "" to keep it.
+func (f *ImageFilter) checkHeader(header imageHeader) string {
+	format := normalizeFormat(header.format)
+	if len(f.formats) > 0 && !slices.Contains(f.formats, format) {
+		return fmt.Sprintf("format %s not in -formats", format)
+	}
+	if slices.Contains(f.excludeFormats, format) {
+		return fmt.Sprintf("format %s excluded", format)
+	}
+
+	if !header.hasDimensions {
+		return ""
+	}
+	w, h := header.width, header.height
+	switch {
+	case f.minWidth > 0 && w < f.minWidth:
+		return fmt.Sprintf("width %d < min-width %d", w, f.minWidth)
+	case f.maxWidth > 0 && w > f.maxWidth:
+		return fmt.Sprintf("width %d > max-width %d", w, f.maxWidth)
+	case f.minHeight > 0 && h < f.minHeight:
+		return fmt.Sprintf("height %d < min-height %d", h, f.minHeight)
+	case f.maxHeight > 0 && h > f.maxHeight:
+		return fmt.Sprintf("height %d > max-height %d", h, f.maxHeight)
+	}
+
+	if h == 0 {
+		return ""
+	}
+	ratio := float64(w) / float64(h)
+	switch {
+	case f.minRatio > 0 && ratio < f.minRatio:
+		return fmt.Sprintf("aspect ratio %.2f < min-ratio %.2f", ratio, f.minRatio)
+	case f.maxRatio > 0 && ratio > f.maxRatio:
+		return fmt.Sprintf("aspect ratio %.2f > max-ratio %.2f", ratio, f.maxRatio)
+	}
+	return ""
+}
+
+func (f *ImageFilter) checkSize(size int64) string {
+	switch {
+	case f.minSize > 0 && size < f.minSize:
+		return fmt.Sprintf("size %d < min-size %d", size, f.minSize)
+	case f.maxSize > 0 && size > f.maxSize:
+		return fmt.Sprintf("size > max-size %d", f.maxSize)
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+func TestFilterRejections(t *testing.T) {
+	var icon bytes.Buffer
+	if err := gif.Encode(&icon, image.NewPaletted(image.Rect(0, 0, 64, 64), []color.Color{color.White}), nil); err != nil {
+		t.Fatal(err)
+	}
+	wide, small := sizedPNG(t, 640, 120), sizedPNG(t, 32, 24)
+	server := testSite(t, map[string][]byte{
+		"/":          []byte(`<html><body><img src="/wide.png"><img src="/small.png"><img src="/icon.gif"></body></html>`),
+		"/wide.png":  wide,
+		"/small.png": small,
+		"/icon.gif":  icon.Bytes(),
+	})
+
+	// the reasons of the rejected images, by path, the others are saved
+	tests := []struct {
+		name   string
+		filter ImageFilter
+		want   map[string]string
+	}{
+		{"no filter", ImageFilter{}, map[string]string{}},
+		{"min-width", ImageFilter{minWidth: 64}, map[string]string{
+			"/small.png": "width 32 < min-width 64",
+		}},
+		{"max-height", ImageFilter{maxHeight: 100}, map[string]string{
+			"/wide.png": "height 120 > max-height 100",
+		}},
+		{"formats", ImageFilter{formats: parseFormatList("png")}, map[string]string{
+			"/icon.gif": "format gif not in -formats",
+		}},
+		{"exclude-formats", ImageFilter{excludeFormats: parseFormatList(".PNG")}, map[string]string{
+			"/wide.png":  "format png excluded",
+			"/small.png": "format png excluded",
+		}},
+		{"max-ratio", ImageFilter{maxRatio: 2}, map[string]string{
+			"/wide.png": "aspect ratio 5.33 > max-ratio 2.00",
+		}},
+		{"min-size", ImageFilter{minSize: int64(len(small)) + 1}, map[string]string{
+			"/small.png": fmt.Sprintf("size %d < min-size %d", len(small), len(small)+1),
+			"/icon.gif":  fmt.Sprintf("size %d < min-size %d", icon.Len(), len(small)+1),
+		}},
+		{"max-size", ImageFilter{maxSize: int64(len(small))}, map[string]string{
+			"/wide.png": fmt.Sprintf("size > max-size %d", len(small)),
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := testCrawl(t, server.URL+"/", t.TempDir(), func(spider *Spider) {
+				spider.filter = test.filter
+			})
+			if len(entries) != 3 {
+				t.Fatalf("manifest %+v, want the 3 images of the page", entries)
+			}
+			for _, entry := range entries {
+				imagePath := strings.TrimPrefix(entry.URL, server.URL)
+				reason, rejected := test.want[imagePath]
+				switch {
+				case rejected && (entry.Status != statusRejected || entry.Reason != reason):
+					t.Errorf("%s: %s %q, want rejected %q", imagePath, entry.Status, entry.Reason, reason)
+				case !rejected && (entry.Status != statusSaved || entry.File == ""):
+					t.Errorf("%s: %s %q, want saved", imagePath, entry.Status, entry.Reason)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// imageFormat is a format Spider downloads: the extensions of its URLs, the
+// Content-Types of its responses and the signature of its files.
+type imageFormat struct {
+	name       string // as given to -formats
+	label      string
+	extensions []string
+	mediaTypes []string
+	signature  func(head []byte) bool
+}
+
+// imageFormats is the table of the formats, the first extension and media
+// type of each are the ones used to name and describe files. It is also the
+// FORMATS section of the help.
+var imageFormats = []imageFormat{
+	{"jpeg", "JPEG/JPG", []string{".jpg", ".jpeg", ".jpe", ".jfif"}, []string{"image/jpeg", "image/jpg", "image/pjpeg"},
+		prefixSignature("\xff\xd8\xff")},
+	{"png", "PNG", []string{".png"}, []string{"image/png", "image/apng"},
+		prefixSignature("\x89PNG\r\n\x1a\n")},
+	{"gif", "GIF", []string{".gif"}, []string{"image/gif"},
+		prefixSignature("GIF87a", "GIF89a")},
+	{"bmp", "BMP", []string{".bmp"}, []string{"image/bmp", "image/x-ms-bmp"},
+		prefixSignature("BM")},
+	{"svg", "SVG", []string{".svg"}, []string{"image/svg+xml"},
+		isSVG},
+	{"webp", "WebP", []string{".webp"}, []string{"image/webp"},
+		func(head []byte) bool {
+			return len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP"
+		}},
+	{"avif", "AVIF", []string{".avif"}, []string{"image/avif"},
+		ftypSignature("avif", "avis")},
+	{"ico", "ICO", []string{".ico", ".cur"}, []string{"image/x-icon", "image/vnd.microsoft.icon"},
+		prefixSignature("\x00\x00\x01\x00", "\x00\x00\x02\x00")},
+	{"tiff", "TIFF", []string{".tif", ".tiff"}, []string{"image/tiff"},
+		prefixSignature("II*\x00", "MM\x00*")},
+	{"heic", "HEIC/HEIF", []string{".heic", ".heif", ".hif"}, []string{"image/heic", "image/heif", "image/heic-sequence", "image/heif-sequence"},
+		ftypSignature("heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1")},
+	{"jxl", "JPEG XL", []string{".jxl"}, []string{"image/jxl"},
+		prefixSignature("\xff\x0a", "\x00\x00\x00\x0cJXL \r\n\x87\n")},
+}
+
+func prefixSignature(prefixes ...string) func([]byte) bool {
+	return func(head []byte) bool {
+		for _, prefix := range prefixes {
+			if bytes.HasPrefix(head, []byte(prefix)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ftypSignature matches the ISO media files (AVIF, HEIF) by the major or a
+// compatible brand of their ftyp box. AVIF encoders often give the generic
+// mif1 as major brand and avif as compatible one, so AVIF is tried before
+// HEIF in the table.
+func ftypSignature(brands ...string) func([]byte) bool {
+	return func(head []byte) bool {
+		if len(head) < 12 || string(head[4:8]) != "ftyp" {
+			return false
+		}
+		if slices.Contains(brands, string(head[8:12])) {
+			return true
+		}
+		// the compatible brands follow the minor version, up to the end of
+		// the box
+		end := min(int(binary.BigEndian.Uint32(head[0:4])), len(head))
+		for i := 16; i+4 <= end; i += 4 {
+			if slices.Contains(brands, string(head[i:i+4])) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func isSVG(head []byte) bool {
+	trimmed := strings.ToLower(strings.TrimSpace(string(head[:min(len(head), 512)])))
+	return strings.HasPrefix(trimmed, "<svg") || strings.HasPrefix(trimmed, "<?xml") && strings.Contains(trimmed, "<svg")
+}
+
+func lookupFormat(name string) *imageFormat {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "."))
+	for i, f := range imageFormats {
+		if f.name == name || slices.Contains(f.extensions, "."+name) || slices.Contains(f.mediaTypes, "image/"+name) {
+			return &imageFormats[i]
+		}
+	}
+	return nil
+}
+
+// formatBySignature is the format of the first bytes of a file, nil when it
+// is none of the table.
+func formatBySignature(head []byte) *imageFormat {
+	for i, f := range imageFormats {
+		if f.signature(head) {
+			return &imageFormats[i]
+		}
+	}
+	return nil
+}
+
+func formatByMediaType(mediaType string) *imageFormat {
+	for i, f := range imageFormats {
+		if slices.Contains(f.mediaTypes, mediaType) {
+			return &imageFormats[i]
+		}
+	}
+	return nil
+}
+
+func formatNames() []string {
+	names := make([]string, len(imageFormats))
+	for i, f := range imageFormats {
+		names[i] = f.name
+	}
+	return names
+}
+
+// acceptedExtensions are the extensions of the formats kept by -formats
+// and -exclude-formats, all of them by default.
+func acceptedExtensions(formats []string, excludeFormats []string) ([]string, error) {
+	for _, name := range append(slices.Clone(formats), excludeFormats...) {
+		if lookupFormat(name) == nil {
+			return nil, fmt.Errorf("unknown image format %s, expected %s", name, strings.Join(formatNames(), ", "))
+		}
+	}
+	var extensions []string
+	for _, f := range imageFormats {
+		if len(formats) > 0 && !slices.Contains(formats, f.name) || slices.Contains(excludeFormats, f.name) {
+			continue
+		}
+		extensions = append(extensions, f.extensions...)
+	}
+	return extensions, nil
+}
+
+// formatsHelp is the FORMATS section of printHelp.
+func formatsHelp() string {
+	var help strings.Builder
+	help.WriteString("FORMATS SUPPORTED (name for -formats, extensions, Content-Types):\n")
+	for _, f := range imageFormats {
+		fmt.Fprintf(&help, "  %-10s %-6s %-24s %s\n", f.label, f.name, strings.Join(f.extensions, " "), strings.Join(f.mediaTypes, " "))
+	}
+	return help.String()
+}
+
+// webpDimensions reads the size of a WebP image from its first chunk,
+// lossy (VP8), lossless (VP8L) or extended (VP8X).
+func webpDimensions(head []byte) (width, height int, ok bool) {
+	if len(head) < 30 {
+		return 0, 0, false
+	}
+	switch string(head[12:16]) {
+	case "VP8X":
+		width = 1 + (int(head[24]) | int(head[25])<<8 | int(head[26])<<16)
+		height = 1 + (int(head[27]) | int(head[28])<<8 | int(head[29])<<16)
+		return width, height, true
+	case "VP8 ":
+		if string(head[23:26]) != "\x9d\x01\x2a" {
+			return 0, 0, false
+		}
+		width = int(binary.LittleEndian.Uint16(head[26:28]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(head[28:30]) & 0x3fff)
+		return width, height, true
+	case "VP8L":
+		if head[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(head[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	}
+	return 0, 0, false
+}
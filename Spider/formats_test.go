@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// ftyp is the ftyp box of an ISO media file with the given brands.
+func ftyp(major string, compatible ...string) []byte {
+	box := binary.BigEndian.AppendUint32(nil, uint32(16+4*len(compatible)))
+	box = append(box, "ftyp"+major+"\x00\x00\x00\x00"...)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	// the next box
+	return append(box, "\x00\x00\x00\x08meta"...)
+}
+
+func TestFormatBySignature(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), "jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), "png"},
+		{"gif", []byte("GIF89a\x01\x00"), "gif"},
+		{"svg", []byte("  <?xml version=\"1.0\"?>\n<svg xmlns=\"http://www.w3.org/2000/svg\">"), "svg"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "webp"},
+		{"avif major brand", ftyp("avif", "mif1", "miaf"), "avif"},
+		{"avif compatible brand", ftyp("mif1", "avif", "mif1", "miaf"), "avif"},
+		{"avif sequence", ftyp("msf1", "avis", "msf1"), "avif"},
+		{"heic", ftyp("heic", "mif1", "heic"), "heic"},
+		{"heif", ftyp("mif1", "mif1", "heic"), "heic"},
+		// a brand after the ftyp box is not one of its brands
+		{"brand after the box", append(ftyp("mif1"), "avif"...), "heic"},
+		{"mp4", ftyp("isom", "iso2", "mp41"), ""},
+		{"jxl codestream", []byte("\xff\x0a\x00"), "jxl"},
+		{"html", []byte("<!doctype html><html>"), ""},
+		{"empty", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if f := formatBySignature(test.head); f != nil {
+				got = f.name
+			}
+			if got != test.want {
+				t.Errorf("formatBySignature() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWebpDimensions(t *testing.T) {
+	riff := func(chunk string, data []byte) []byte {
+		head := []byte("RIFF\x00\x00\x00\x00WEBP" + chunk + "\x00\x00\x00\x00")
+		// padded as by the rest of the bitstream
+		return append(append(head, data...), make([]byte, 16)...)
+	}
+	tests := []struct {
+		name          string
+		head          []byte
+		width, height int
+		ok            bool
+	}{
+		{
+			name:  "extended",
+			head:  riff("VP8X", []byte{0, 0, 0, 0, 0x1f, 0x03, 0x00, 0xdf, 0x01, 0x00}),
+			width: 800, height: 480, ok: true,
+		},
+		{
+			name:  "lossy",
+			head:  riff("VP8 ", []byte{0, 0, 0, 0x9d, 0x01, 0x2a, 0x20, 0x03, 0xe0, 0x01}),
+			width: 800, height: 480, ok: true,
+		},
+		{
+			name: "lossy bad start code",
+			head: riff("VP8 ", []byte{0, 0, 0, 0, 0, 0, 0x20, 0x03, 0xe0, 0x01}),
+			ok:   false,
+		},
+		{
+			// 14 bits of width-1 then 14 bits of height-1
+			name:  "lossless",
+			head:  riff("VP8L", binary.LittleEndian.AppendUint32([]byte{0x2f}, 799|479<<14|1<<28)),
+			width: 800, height: 480, ok: true,
+		},
+		{
+			name: "lossless bad signature",
+			head: riff("VP8L", binary.LittleEndian.AppendUint32([]byte{0}, 799|479<<14)),
+			ok:   false,
+		},
+		{
+			name: "truncated",
+			head: []byte("RIFF\x00\x00\x00\x00WEBPVP8X"),
+			ok:   false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			width, height, ok := webpDimensions(test.head)
+			if width != test.width || height != test.height || ok != test.ok {
+				t.Errorf("webpDimensions() = %d, %d, %v, want %d, %d, %v", width, height, ok, test.width, test.height, test.ok)
+			}
+		})
+	}
+}
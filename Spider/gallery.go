@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+const (
+	thumbnailSize = 200
+	// larger SVG files are linked, not embedded
+	maxInlineSvg = 256 * 1024
+)
+
+type galleryImage struct {
+	ManifestEntry
+	Metadata [][2]string
+	GPS      *scorpionGPS
+}
+
+// Gallery keeps every manifest entry of the crawl to write the HTML report.
+// A nil *Gallery keeps nothing.
+type Gallery struct {
+	images []*galleryImage
+	// by SHA256, near-duplicates removed afterwards keep theirs
+	metadata map[string]*scorpionResult
+}
+
+func newGallery() *Gallery {
+	return &Gallery{metadata: make(map[string]*scorpionResult)}
+}
+
+func (g *Gallery) Add(entry ManifestEntry) {
+	if g == nil {
+		return
+	}
+	if entry.Status == statusNearDuplicate {
+		// the image was reported as saved first, update it in place
+		for _, img := range g.images {
+			if img.Status == statusSaved && img.SHA256 == entry.SHA256 && img.URL == entry.URL {
+				img.ManifestEntry = entry
+				return
+			}
+		}
+	}
+	g.images = append(g.images, &galleryImage{ManifestEntry: entry})
+}
+
+func (g *Gallery) AddMetadata(sha256 string, result *scorpionResult) {
+	if g == nil {
+		return
+	}
+	g.metadata[sha256] = result
+}
+
+type galleryPage struct {
+	Page   string
+	Images []galleryView
+}
+
+type galleryView struct {
+	*galleryImage
+	Thumbnail template.URL
+	Link      string
+	Original  string
+}
+
+// Write renders the report as a single HTML file, thumbnails included.
+func (g *Gallery) Write(reportPath string) error {
+	if g == nil {
+		return nil
+	}
+	reportDir := filepath.Dir(reportPath)
+	link := func(filePath string) string {
+		if filePath == "" {
+			return ""
+		}
+		if abs, err := filepath.Abs(filePath); err == nil {
+			filePath = abs
+		}
+		if absDir, err := filepath.Abs(reportDir); err == nil {
+			if rel, err := filepath.Rel(absDir, filePath); err == nil {
+				return filepath.ToSlash(rel)
+			}
+		}
+		return filepath.ToSlash(filePath)
+	}
+
+	thumbnails := make(map[string]template.URL)
+	byPage := make(map[string]*galleryPage)
+	var pages []*galleryPage
+	counts := make(map[string]int)
+	for _, img := range g.images {
+		counts[img.Status]++
+		if result := g.metadata[img.SHA256]; img.SHA256 != "" && result != nil {
+			img.GPS = result.GPS
+			img.Metadata = nil
+			// the key fields are the ones telling about the author
+			categories := classifyLeaks(result.Tags)
+			for _, name := range leakCategoryNames(categories) {
+				keys := slices.Sorted(maps.Keys(categories[name]))
+				for _, key := range keys {
+					img.Metadata = append(img.Metadata, [2]string{key, categories[name][key]})
+				}
+			}
+		}
+
+		view := galleryView{galleryImage: img, Link: link(img.File)}
+		shown := img.File
+		if img.Status == statusDuplicate || img.Status == statusNearDuplicate {
+			view.Original = link(img.DuplicateOf)
+			if shown == "" {
+				shown = img.DuplicateOf
+			}
+		}
+		if shown != "" {
+			if _, ok := thumbnails[shown]; !ok {
+				thumbnails[shown] = thumbnailURI(shown)
+			}
+			view.Thumbnail = thumbnails[shown]
+		}
+
+		page := byPage[img.Page]
+		if page == nil {
+			page = &galleryPage{Page: img.Page}
+			byPage[img.Page] = page
+			pages = append(pages, page)
+		}
+		page.Images = append(page.Images, view)
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Page != "" && pages[j].Page == "" })
+
+	var buf bytes.Buffer
+	err := galleryTemplate.Execute(&buf, map[string]any{
+		"Pages":  pages,
+		"Total":  len(g.images),
+		"Counts": counts,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(reportPath, buf.Bytes(), 0644)
+}
+
+// thumbnailURI returns a JPEG thumbnail of the image as a data URI. SVG
+// files are embedded as they are, formats the stdlib can't decode get none.
+func thumbnailURI(filePath string) template.URL {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	if sniffImage(content).format == "svg" {
+		if len(content) > maxInlineSvg {
+			return ""
+		}
+		return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(content))
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail(img, thumbnailSize), &jpeg.Options{Quality: 75}); err != nil {
+		return ""
+	}
+	return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+// thumbnail scales img down to fit in size x size, averaging the source
+// pixels of each target pixel, on a white background for transparent images.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return image.NewRGBA(image.Rect(0, 0, 1, 1))
+	}
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// premultiplied, over white
+					cr, cg, cb, ca := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b = r+uint64(cr+0xffff-ca), g+uint64(cg+0xffff-ca), b+uint64(cb+0xffff-ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(b / n >> 8), 0xff})
+		}
+	}
+	return dst
+}
+
+func humanSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Funcs(template.FuncMap{
+	"humanSize": humanSize,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Spider report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #fafafa; color: #222; }
+h2 { font-size: 1em; word-break: break-all; border-bottom: 1px solid #ccc; padding-bottom: .3em; }
+.grid { display: flex; flex-wrap: wrap; gap: 1em; }
+.card { width: 220px; background: #fff; border: 1px solid #ddd; padding: .5em; font-size: .8em; }
+.card .thumb { height: 200px; display: flex; align-items: center; justify-content: center; background: #eee; }
+.card .thumb img { max-width: 200px; max-height: 200px; }
+.card p { margin: .3em 0; word-break: break-all; }
+.status { font-weight: bold; }
+.saved { border-left: 4px solid #2a2; }
+.duplicate, .near_duplicate { border-left: 4px solid #c90; }
+.rejected { border-left: 4px solid #888; }
+.error { border-left: 4px solid #c22; }
+table { border-collapse: collapse; }
+td { padding: 0 .4em 0 0; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Spider report</h1>
+<p>{{.Total}} image(s){{range $status, $count := .Counts}} &middot; {{$count}} {{$status}}{{end}}</p>
+{{range .Pages}}
+<h2>{{if .Page}}<a href="{{.Page}}">{{.Page}}</a>{{else}}No page{{end}} ({{len .Images}})</h2>
+<div class="grid">
+{{range .Images}}
+<div class="card {{.Status}}">
+<div class="thumb">{{if .Thumbnail}}{{if .Link}}<a href="{{.Link}}">{{end}}<img src="{{.Thumbnail}}" alt="">{{if .Link}}</a>{{end}}{{else}}no preview{{end}}</div>
+<p><a href="{{.URL}}">{{.URL}}</a></p>
+<p class="status">{{.Status}}{{if .Reason}}: {{.Reason}}{{end}}</p>
+<p>{{.Source}}{{if .Format}} &middot; {{.Format}}{{end}}{{if .Width}} &middot; {{.Width}}x{{.Height}}{{end}}{{if .Size}} &middot; {{humanSize .Size}}{{end}}</p>
+{{if .DuplicateOf}}<p>duplicate of {{if .Original}}<a href="{{.Original}}">{{.DuplicateOf}}</a>{{else}}{{.DuplicateOf}}{{end}}</p>{{end}}
+{{if .Metadata}}<table>{{range .Metadata}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>{{end}}</table>{{end}}
+{{if .GPS}}<p>GPS {{printf "%.6f" .GPS.Latitude}}, {{printf "%.6f" .GPS.Longitude}} &middot; <a href="{{.GPS.OpenStreetMap}}">map</a></p>{{end}}
+</div>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGalleryMetadataOfRemovedNearDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	gallery := newGallery()
+	kept := ManifestEntry{URL: "http://a/large.png", File: filepath.Join(dir, "large.png"), SHA256: "aaaa", Status: statusSaved}
+	removed := ManifestEntry{URL: "http://a/small.png", File: filepath.Join(dir, "small.png"), SHA256: "bbbb", Status: statusSaved}
+	gallery.Add(kept)
+	gallery.Add(removed)
+	gallery.AddMetadata(removed.SHA256, &scorpionResult{Tags: map[string]string{"Artist": "Jane Roe"}})
+
+	// reportNearDuplicates removes the file
+	removed.Status = statusNearDuplicate
+	removed.DuplicateOf = kept.File
+	removed.File = ""
+	gallery.Add(removed)
+
+	reportPath := filepath.Join(dir, "gallery.html")
+	if err := gallery.Write(reportPath); err != nil {
+		t.Fatal(err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "Jane Roe") {
+		t.Error("the metadata of the removed near-duplicate is missing from the report")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		img           image.Image
+		width, height int
+		corner        color.RGBA
+	}{
+		{
+			name:  "landscape",
+			img:   fillImage(image.Rect(0, 0, 800, 400), color.NRGBA{0, 0, 255, 255}),
+			width: 200, height: 100,
+			corner: color.RGBA{0, 0, 255, 255},
+		},
+		{
+			name:  "portrait, offset bounds",
+			img:   fillImage(image.Rect(50, 50, 350, 650), color.NRGBA{255, 0, 0, 255}),
+			width: 100, height: 200,
+			corner: color.RGBA{255, 0, 0, 255},
+		},
+		{
+			name:  "small, kept as is",
+			img:   fillImage(image.Rect(0, 0, 20, 10), color.NRGBA{0, 255, 0, 255}),
+			width: 20, height: 10,
+			corner: color.RGBA{0, 255, 0, 255},
+		},
+		{
+			name:  "transparent, on white",
+			img:   fillImage(image.Rect(0, 0, 400, 400), color.NRGBA{0, 0, 0, 0}),
+			width: 200, height: 200,
+			corner: color.RGBA{255, 255, 255, 255},
+		},
+		{
+			name:  "empty",
+			img:   image.NewRGBA(image.Rectangle{}),
+			width: 1, height: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			thumb := thumbnail(test.img, thumbnailSize)
+			bounds := thumb.Bounds()
+			if bounds.Dx() != test.width || bounds.Dy() != test.height {
+				t.Fatalf("thumbnail is %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), test.width, test.height)
+			}
+			if got := color.RGBAModel.Convert(thumb.At(0, 0)); got != test.corner {
+				t.Errorf("thumbnail pixel is %v, want %v", got, test.corner)
+			}
+		})
+	}
+}
+
+func fillImage(rect image.Rectangle, c color.NRGBA) image.Image {
+	img := image.NewNRGBA(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	nodePage  = "page"
+	nodeImage = "image"
+	edgeLink  = "link"
+	edgeImage = "image"
+)
+
+type GraphNode struct {
+	ID          string `json:"id"`
+	Kind        string `json:"kind"`
+	Depth       int    `json:"depth"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	ImageCount  int    `json:"image_count"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// CrawlGraph records pages and images as nodes and the links between them.
+// A nil *CrawlGraph records nothing.
+type CrawlGraph struct {
+	nodes    map[string]*GraphNode
+	order    []string
+	edges    []GraphEdge
+	edgeSeen map[GraphEdge]bool
+}
+
+func newCrawlGraph() *CrawlGraph {
+	return &CrawlGraph{nodes: make(map[string]*GraphNode), edgeSeen: make(map[GraphEdge]bool)}
+}
+
+func (g *CrawlGraph) node(id string, kind string) *GraphNode {
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &GraphNode{ID: id, Kind: kind, Depth: -1}
+		g.nodes[id] = n
+		g.order = append(g.order, id)
+	}
+	return n
+}
+
+func (g *CrawlGraph) addEdge(from string, to string, kind string) {
+	edge := GraphEdge{from, to, kind}
+	if g.edgeSeen[edge] {
+		return
+	}
+	g.edgeSeen[edge] = true
+	g.edges = append(g.edges, edge)
+
+	source := g.node(from, nodePage)
+	target := g.node(to, nodePage)
+	if kind == edgeImage {
+		target.Kind = nodeImage
+		source.ImageCount++
+	}
+	if target.Depth < 0 && source.Depth >= 0 {
+		target.Depth = source.Depth + 1
+		if kind == edgeImage {
+			target.Depth = source.Depth
+		}
+	}
+}
+
+func (g *CrawlGraph) PageVisited(pageUrl string, depth int) {
+	if g == nil {
+		return
+	}
+	n := g.node(pageUrl, nodePage)
+	if n.Depth < 0 || depth < n.Depth {
+		n.Depth = depth
+	}
+}
+
+func (g *CrawlGraph) PageFetched(pageUrl string, status int, contentType string) {
+	if g == nil {
+		return
+	}
+	n := g.node(pageUrl, nodePage)
+	n.Status = status
+	n.ContentType = contentType
+}
+
+func (g *CrawlGraph) Link(from string, to string) {
+	if g == nil || from == to {
+		return
+	}
+	g.addEdge(from, to, edgeLink)
+}
+
+func (g *CrawlGraph) Image(page string, imageUrl string, status int, contentType string) {
+	if g == nil || page == "" {
+		return
+	}
+	g.addEdge(page, imageUrl, edgeImage)
+	n := g.node(imageUrl, nodeImage)
+	if status != 0 {
+		n.Status = status
+	}
+	if contentType != "" {
+		n.ContentType = contentType
+	}
+}
+
+// Export writes prefix.dot, prefix.graphml and prefix.json.
+func (g *CrawlGraph) Export(prefix string) error {
+	if g == nil {
+		return nil
+	}
+	for ext, render := range map[string]func() ([]byte, error){
+		".dot":     g.dot,
+		".graphml": g.graphML,
+		".json":    g.json,
+	} {
+		content, err := render()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(prefix+ext, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *CrawlGraph) dot() ([]byte, error) {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	var buf bytes.Buffer
+	buf.WriteString("digraph crawl {\n\trankdir=LR;\n")
+	for _, id := range g.order {
+		n := g.nodes[id]
+		shape := "box"
+		if n.Kind == nodeImage {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&buf, "\t%s [kind=%s shape=%s depth=%d status=%d content_type=%s image_count=%d];\n",
+			quote(n.ID), n.Kind, shape, n.Depth, n.Status, quote(n.ContentType), n.ImageCount)
+	}
+	for _, e := range g.edges {
+		style := "solid"
+		if e.Kind == edgeImage {
+			style = "dashed"
+		}
+		fmt.Fprintf(&buf, "\t%s -> %s [kind=%s style=%s];\n", quote(e.From), quote(e.To), e.Kind, style)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+func (g *CrawlGraph) graphML() ([]byte, error) {
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+	type node struct {
+		ID   string `xml:"id,attr"`
+		Data []data `xml:"data"`
+	}
+	type edge struct {
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+		Data   []data `xml:"data"`
+	}
+	type key struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+		Type string `xml:"attr.type,attr"`
+	}
+	type graph struct {
+		ID          string `xml:"id,attr"`
+		EdgeDefault string `xml:"edgedefault,attr"`
+		Nodes       []node `xml:"node"`
+		Edges       []edge `xml:"edge"`
+	}
+	type graphml struct {
+		XMLName xml.Name `xml:"graphml"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Keys    []key    `xml:"key"`
+		Graph   graph    `xml:"graph"`
+	}
+
+	doc := graphml{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []key{
+			{"kind", "node", "kind", "string"},
+			{"depth", "node", "depth", "int"},
+			{"status", "node", "status", "int"},
+			{"content_type", "node", "content_type", "string"},
+			{"image_count", "node", "image_count", "int"},
+			{"edge_kind", "edge", "kind", "string"},
+		},
+		Graph: graph{ID: "crawl", EdgeDefault: "directed"},
+	}
+	for _, id := range g.order {
+		n := g.nodes[id]
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node{ID: n.ID, Data: []data{
+			{"kind", n.Kind},
+			{"depth", fmt.Sprint(n.Depth)},
+			{"status", fmt.Sprint(n.Status)},
+			{"content_type", n.ContentType},
+			{"image_count", fmt.Sprint(n.ImageCount)},
+		}})
+	}
+	for _, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, edge{Source: e.From, Target: e.To, Data: []data{{"edge_kind", e.Kind}}})
+	}
+
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(content, '\n')...), nil
+}
+
+func (g *CrawlGraph) json() ([]byte, error) {
+	nodes := make([]*GraphNode, 0, len(g.order))
+	for _, id := range g.order {
+		nodes = append(nodes, g.nodes[id])
+	}
+	return json.MarshalIndent(map[string]any{"nodes": nodes, "edges": g.edges}, "", "  ")
+}
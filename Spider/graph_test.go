@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGraphExport(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/":          []byte(`<html><body><img src="/a.png"><a href="/page.html">page</a><a href="/missing.html">gone</a></body></html>`),
+		"/page.html": []byte(`<html><body><img src="/b.png"><img src="/a.png"><a href="/">home</a></body></html>`),
+		"/a.png":     testPNG(t, 1),
+		"/b.png":     testPNG(t, 2),
+	})
+	prefix := filepath.Join(t.TempDir(), "crawl")
+	spider := newTestSpider(t)
+	spider.graph = newCrawlGraph()
+	crawlTestSeed(t, spider, server.URL+"/", t.TempDir())
+	if err := spider.graph.Export(prefix); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(prefix + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	site := server.URL
+	html := "text/html; charset=utf-8"
+	wantNodes := []GraphNode{
+		{ID: site + "/", Kind: nodePage, Depth: 1, Status: 200, ContentType: html, ImageCount: 1},
+		{ID: site + "/a.png", Kind: nodeImage, Depth: 1, Status: 200, ContentType: "image/png"},
+		{ID: site + "/page.html", Kind: nodePage, Depth: 2, Status: 200, ContentType: html, ImageCount: 2},
+		{ID: site + "/missing.html", Kind: nodePage, Depth: 2, Status: 404, ContentType: "text/plain; charset=utf-8"},
+		{ID: site + "/b.png", Kind: nodeImage, Depth: 2, Status: 200, ContentType: "image/png"},
+	}
+	wantEdges := []GraphEdge{
+		{site + "/", site + "/a.png", edgeImage},
+		{site + "/", site + "/page.html", edgeLink},
+		{site + "/", site + "/missing.html", edgeLink},
+		{site + "/page.html", site + "/b.png", edgeImage},
+		{site + "/page.html", site + "/a.png", edgeImage},
+		{site + "/page.html", site + "/", edgeLink},
+	}
+	if !reflect.DeepEqual(got.Nodes, wantNodes) {
+		t.Errorf("nodes = %+v, want %+v", got.Nodes, wantNodes)
+	}
+	if !reflect.DeepEqual(got.Edges, wantEdges) {
+		t.Errorf("edges = %+v, want %+v", got.Edges, wantEdges)
+	}
+
+	dot, err := os.ReadFile(prefix + ".dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`"` + site + `/missing.html" [kind=page shape=box depth=2 status=404 content_type="text/plain; charset=utf-8" image_count=0];`,
+		`"` + site + `/b.png" [kind=image shape=ellipse depth=2 status=200 content_type="image/png" image_count=0];`,
+		`"` + site + `/page.html" -> "` + site + `/b.png" [kind=image style=dashed];`,
+		`"` + site + `/" -> "` + site + `/page.html" [kind=link style=solid];`,
+	} {
+		if !strings.Contains(string(dot), "\t"+line+"\n") {
+			t.Errorf("crawl.dot lacks %s in\n%s", line, dot)
+		}
+	}
+
+	content, err = os.ReadFile(prefix + ".graphml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var graphml struct {
+		Nodes []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(content, &graphml); err != nil {
+		t.Fatal(err)
+	}
+	if len(graphml.Nodes) != len(wantNodes) || len(graphml.Edges) != len(wantEdges) {
+		t.Errorf("crawl.graphml has %d nodes and %d edges, want %d and %d", len(graphml.Nodes), len(graphml.Edges), len(wantNodes), len(wantEdges))
+	}
+	for i, edge := range graphml.Edges {
+		if i < len(wantEdges) && (edge.Source != wantEdges[i].From || edge.Target != wantEdges[i].To) {
+			t.Errorf("crawl.graphml edge %d = %s -> %s, want %s -> %s", i, edge.Source, edge.Target, wantEdges[i].From, wantEdges[i].To)
+		}
+	}
+}
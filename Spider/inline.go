@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"mime"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var cssDataURI = regexp.MustCompile(`url\(\s*['"]?(data:[^'")]+)['"]?\s*\)`)
+
+func isDataURI(value string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "data:")
+}
+
+// decodeDataURI decodes a data: URI, base64 or percent-encoded, and returns
+// its media type and content.
+func decodeDataURI(uri string) (string, []byte, error) {
+	uri = strings.TrimSpace(uri)
+	header, payload, ok := strings.Cut(uri[len("data:"):], ",")
+	if !ok {
+		return "", nil, errors.New("data URI without payload")
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	isBase64 := strings.EqualFold(strings.TrimSpace(params[len(params)-1]), "base64")
+
+	if isBase64 {
+		// data URIs in HTML are often wrapped or percent-encoded
+		if unescaped, err := url.PathUnescape(payload); err == nil {
+			payload = unescaped
+		}
+		payload = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+				return -1
+			}
+			return r
+		}, payload)
+		content, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			content, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		}
+		return mediaType, content, err
+	}
+
+	content, err := url.PathUnescape(payload)
+	return mediaType, []byte(content), err
+}
+
+func mediaTypeExtension(mediaType string) string {
+	if f := formatByMediaType(mediaType); f != nil {
+		return f.extensions[0]
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func download_data_uri(uri string, spider *Spider, page string, source string) {
+	mediaType, content, err := decodeDataURI(uri)
+	ref := imageRef{url: "data:" + mediaType, page: page, source: source + ":data-uri"}
+	if err != nil {
+		log.Printf("Error decoding data URI on %s: %v\n", page, err)
+		recordImageError(spider, ref, err.Error())
+		return
+	}
+
+	ext := mediaTypeExtension(mediaType)
+	if !slices.Contains(spider.valid_ext, ext) {
+		return
+	}
+	storeImage(spider, ref, contentFileName("data", content, ext), bytes.NewReader(content))
+}
+
+// extract_css_data_uris yields the data URIs of <style> elements and style
+// attributes.
+func extract_css_data_uris(n *html.Node, spider *Spider, page string) []Candidate {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	css := getAttr(n, "style")
+	if n.DataAtom == atom.Style && n.FirstChild != nil {
+		css = n.FirstChild.Data
+	}
+	var candidates []Candidate
+	for _, match := range cssDataURI.FindAllStringSubmatch(css, -1) {
+		candidates = append(candidates, Candidate{Kind: candidateImage, URL: match[1], Source: "css"})
+	}
+	return candidates
+}
+
+// extract_srcset_data_uris yields the data URIs of srcset attributes, the
+// other srcset URLs being variants of the src.
+func extract_srcset_data_uris(n *html.Node, spider *Spider, page string) []Candidate {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	var candidates []Candidate
+	for _, uri := range parseSrcset(getAttr(n, "srcset")) {
+		if isDataURI(uri) {
+			candidates = append(candidates, Candidate{Kind: candidateImage, URL: uri, Source: "srcset"})
+		}
+	}
+	return candidates
+}
+
+// parseSrcset returns the URLs of a srcset attribute. URLs may contain
+// commas (data URIs), so candidates are split on the whitespace that
+// follows each URL rather than on commas alone.
+func parseSrcset(srcset string) []string {
+	var urls []string
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return urls
+		}
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+		candidate := s[:end]
+		s = s[end:]
+		if !isDataURI(candidate) {
+			candidate = strings.TrimRight(candidate, ",")
+		}
+		if candidate != "" {
+			urls = append(urls, candidate)
+		}
+		// skip descriptors up to the next candidate
+		if comma := strings.IndexByte(s, ','); comma >= 0 {
+			s = s[comma+1:]
+		} else {
+			s = ""
+		}
+	}
+}
+
+// extract_inline_svg yields, with -svg, an <svg> element of the page as a
+// standalone file. Nested <svg> elements are part of their outermost one.
+func extract_inline_svg(n *html.Node, spider *Spider, page string) []Candidate {
+	if !spider.inlineSvg || n.Type != html.ElementNode || n.DataAtom != atom.Svg {
+		return nil
+	}
+	if n.Parent != nil && n.Parent.Namespace == "svg" {
+		return nil
+	}
+	if !slices.Contains(spider.valid_ext, ".svg") {
+		return nil
+	}
+
+	hasXmlns := false
+	for _, a := range n.Attr {
+		if a.Key == "xmlns" {
+			hasXmlns = true
+		}
+	}
+
+	var buf bytes.Buffer
+	if !hasXmlns {
+		// Render writes a standalone copy, the page itself is left untouched
+		clone := *n
+		clone.Attr = append([]html.Attribute{{Key: "xmlns", Val: "http://www.w3.org/2000/svg"}}, n.Attr...)
+		clone.Parent, clone.PrevSibling, clone.NextSibling = nil, nil, nil
+		if err := html.Render(&buf, &clone); err != nil {
+			return nil
+		}
+	} else if err := html.Render(&buf, n); err != nil {
+		return nil
+	}
+
+	return []Candidate{{Kind: candidateImage, URL: page + "#svg", Source: "inline-svg", Typed: true, Content: buf.Bytes()}}
+}
+
+func contentFileName(prefix string, content []byte, ext string) string {
+	sum := sha256.Sum256(content)
+	return prefix + "-" + hex.EncodeToString(sum[:6]) + ext
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeDataURI(t *testing.T) {
+	tests := []struct {
+		uri       string
+		mediaType string
+		content   string
+		err       bool
+	}{
+		{"data:image/png;base64,aGVsbG8=", "image/png", "hello", false},
+		{"  DATA:Image/PNG;BASE64,aGVsbG8=  ", "image/png", "hello", false},
+		{"data:image/png;base64,aGVs\n bG8=", "image/png", "hello", false},
+		{"data:image/png;base64,aGVsbG8", "image/png", "hello", false},
+		{"data:image/png;base64,aGVsbG8%3D", "image/png", "hello", false},
+		{"data:image/svg+xml;charset=utf-8,%3Csvg%2F%3E", "image/svg+xml", "<svg/>", false},
+		{"data:image/svg+xml,<svg width='1'/>", "image/svg+xml", "<svg width='1'/>", false},
+		{"data:,hello", "text/plain", "hello", false},
+		{"data:image/png;base64", "", "", true},
+		{"data:image/png;base64,!!!", "image/png", "", true},
+	}
+	for _, test := range tests {
+		mediaType, content, err := decodeDataURI(test.uri)
+		if (err != nil) != test.err {
+			t.Errorf("decodeDataURI(%q) error %v, want error %v", test.uri, err, test.err)
+			continue
+		}
+		if err == nil && (mediaType != test.mediaType || string(content) != test.content) {
+			t.Errorf("decodeDataURI(%q) = %q, %q, want %q, %q", test.uri, mediaType, content, test.mediaType, test.content)
+		}
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		srcset string
+		want   []string
+	}{
+		{"", nil},
+		{"a.jpg", []string{"a.jpg"}},
+		{"a.jpg 1x, b.jpg 2x", []string{"a.jpg", "b.jpg"}},
+		{"a.jpg 480w,b.jpg 800w", []string{"a.jpg", "b.jpg"}},
+		{"a.jpg,b.jpg", []string{"a.jpg,b.jpg"}},
+		{"  a.jpg  1x ,\n b.jpg  2x  ", []string{"a.jpg", "b.jpg"}},
+		{"a,b.jpg 1x, c.jpg 2x", []string{"a,b.jpg", "c.jpg"}},
+		{"data:image/png;base64,aGVsbG8= 1x, b.jpg 2x", []string{"data:image/png;base64,aGVsbG8=", "b.jpg"}},
+	}
+	for _, test := range tests {
+		if got := parseSrcset(test.srcset); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSrcset(%q) = %q, want %q", test.srcset, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// scorpionResult is one line of `scorpion -json`.
+type scorpionResult struct {
+	File  string            `json:"file"`
+	Tags  map[string]string `json:"tags"`
+	GPS   *scorpionGPS      `json:"gps"`
+	Error string            `json:"error"`
+}
+
+type scorpionGPS struct {
+	Latitude      float64 `json:"latitude"`
+	Longitude     float64 `json:"longitude"`
+	OpenStreetMap string  `json:"openstreetmap"`
+}
+
+// leakCategories lists, for each kind of leak, the metadata keys of Scorpion
+// revealing it. Keys starting with GPS are always location leaks.
+var leakCategories = []struct {
+	name string
+	keys []string
+}{
+	{"gps", nil},
+	{"camera", []string{"Make", "Model", "BodySerialNumber", "LensSerialNumber", "SerialNumber", "LensMake", "LensModel", "ImageUniqueID"}},
+	{"author", []string{"Artist", "Author", "Copyright", "CameraOwnerName", "XMP:Creator", "IPTC:Byline", "IPTC:Copyright"}},
+	{"software", []string{"Software", "XMP:CreatorTool", "ProcessingSoftware"}},
+	{"timestamp", []string{"DateTime", "DateTimeOriginal", "DateTimeDigitized", "OffsetTime", "OffsetTimeOriginal", "OffsetTimeDigitized", "ModificationTime", "Creation Time"}},
+}
+
+type leakImage struct {
+	URL        string                       `json:"url"`
+	Page       string                       `json:"page,omitempty"`
+	File       string                       `json:"file"`
+	Categories map[string]map[string]string `json:"categories"`
+	GPS        *scorpionGPS                 `json:"gps,omitempty"`
+	// the metadata was found in the image as downloaded and is not in the
+	// file stored, with -strip-metadata
+	Stripped bool `json:"stripped,omitempty"`
+}
+
+type leakSite struct {
+	Site          string      `json:"site"`
+	ImagesScanned int         `json:"images_scanned"`
+	ImagesLeaking int         `json:"images_leaking"`
+	Leaks         []leakImage `json:"leaks"`
+}
+
+// runScorpion hands an image to the Scorpion format handlers through
+// `scorpion -json`. Scorpion is its own module, so it is run as a program.
+// Some of its handlers report their errors on stderr only, which is
+// returned with the output.
+func runScorpion(spider *Spider, args ...string) ([]byte, string, error) {
+	cmd := exec.Command(spider.scorpionBin, append([]string{"-json"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v %s", spider.scorpionBin, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, strings.TrimSpace(stderr.String()), nil
+}
+
+func scorpionTags(spider *Spider, filePath string) (*scorpionResult, error) {
+	out, _, err := runScorpion(spider, filePath)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var result scorpionResult
+		if json.Unmarshal(scanner.Bytes(), &result) == nil && result.File == filePath {
+			if result.Error != "" {
+				return nil, fmt.Errorf("%s", result.Error)
+			}
+			return &result, nil
+		}
+	}
+	return nil, fmt.Errorf("scorpion gave no result for %s", filePath)
+}
+
+// classifyLeaks sorts the tags revealing something about the author of an
+// image by leak category.
+func classifyLeaks(tags map[string]string) map[string]map[string]string {
+	categories := make(map[string]map[string]string)
+	for key, value := range tags {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		for _, category := range leakCategories {
+			if (category.name == "gps" && strings.HasPrefix(key, "GPS")) || slices.Contains(category.keys, key) {
+				if categories[category.name] == nil {
+					categories[category.name] = make(map[string]string)
+				}
+				categories[category.name][key] = value
+				break
+			}
+		}
+	}
+	return categories
+}
+
+func leakCategoryNames(categories map[string]map[string]string) []string {
+	var names []string
+	for _, category := range leakCategories {
+		if _, ok := categories[category.name]; ok {
+			names = append(names, category.name)
+		}
+	}
+	return names
+}
+
+func siteOf(entry ManifestEntry) string {
+	for _, raw := range []string{entry.Page, entry.URL} {
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	return "local"
+}
+
+// scanImageLeaks runs Scorpion on a stored image and keeps it for the leak
+// report when its metadata reveals anything. original is the scan of the
+// image as downloaded when -strip-metadata cleaned it before storing: its
+// leaks are reported as stripped.
+func scanImageLeaks(spider *Spider, entry ManifestEntry, original *scorpionResult) {
+	site := siteOf(entry)
+	report := spider.leakSites[site]
+	if report == nil {
+		report = &leakSite{Site: site, Leaks: []leakImage{}}
+		spider.leakSites[site] = report
+	}
+	report.ImagesScanned++
+
+	result := original
+	if result == nil {
+		var err error
+		if result, err = scorpionTags(spider, entry.File); err != nil {
+			return
+		}
+		spider.gallery.AddMetadata(entry.SHA256, result)
+	}
+	categories := classifyLeaks(result.Tags)
+	if len(categories) == 0 {
+		return
+	}
+
+	report.ImagesLeaking++
+	report.Leaks = append(report.Leaks, leakImage{
+		URL:        entry.URL,
+		Page:       entry.Page,
+		File:       entry.File,
+		Categories: categories,
+		GPS:        result.GPS,
+		Stripped:   original != nil,
+	})
+	fmt.Println("LEAK:", entry.URL, "|", strings.Join(leakCategoryNames(categories), ", "))
+}
+
+// forgetLeakScan takes out of the leak report an image removed after it was
+// scanned, by -near-dup.
+func forgetLeakScan(spider *Spider, entry ManifestEntry) {
+	report := spider.leakSites[siteOf(entry)]
+	if report == nil {
+		return
+	}
+	report.ImagesScanned--
+	i := slices.IndexFunc(report.Leaks, func(leak leakImage) bool { return leak.File == entry.File })
+	if i >= 0 {
+		report.Leaks = slices.Delete(report.Leaks, i, i+1)
+		report.ImagesLeaking--
+	}
+}
+
+// writeLeakReport writes the per-site leak report and prints its summary.
+func writeLeakReport(spider *Spider) {
+	if spider.leakReport == "" {
+		return
+	}
+	var sites []*leakSite
+	for _, site := range spider.leakSites {
+		sites = append(sites, site)
+	}
+	sort.Slice(sites, func(i, j int) bool { return sites[i].Site < sites[j].Site })
+
+	for _, site := range sites {
+		fmt.Printf("LEAKS: %s | %d/%d image(s) leaking metadata\n", site.Site, site.ImagesLeaking, site.ImagesScanned)
+	}
+
+	content, err := json.MarshalIndent(map[string]any{"sites": sites}, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := os.WriteFile(spider.leakReport, content, 0644); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("LEAK REPORT:", spider.leakReport)
+}
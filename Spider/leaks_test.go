@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLeakReport(t *testing.T) {
+	scorpion := testScorpion(t)
+	server := testSite(t, map[string][]byte{
+		"/":           []byte(`<html><body><img src="/photo.jpg"><img src="/clean.png"></body></html>`),
+		"/photo.jpg":  exifJPEG(t, "Jane Roe"),
+		"/clean.png":  testPNG(t, 0),
+		"/other.html": []byte(`<html><body><img src="/clean.png"></body></html>`),
+	})
+
+	tests := []struct {
+		name      string
+		seed      string
+		stripMeta bool
+		want      string
+	}{
+		{"leaking", "/", false, `[{"categories":{"author":{"Artist":"Jane Roe"}},"file":"photo.jpg"}]`},
+		// the leaks are the ones of the images as downloaded
+		{"stripped", "/", true, `[{"categories":{"author":{"Artist":"Jane Roe"}},"file":"photo.jpg","stripped":true}]`},
+		{"clean", "/other.html", false, `[]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			reportPath := filepath.Join(t.TempDir(), "leaks.json")
+			var spider *Spider
+			testCrawl(t, server.URL+test.seed, dir, func(s *Spider) {
+				spider = s
+				s.scorpionBin = scorpion
+				s.stripMeta = test.stripMeta
+				s.leakReport = reportPath
+				s.leakSites = make(map[string]*leakSite)
+			})
+			writeLeakReport(spider)
+
+			content, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var report struct {
+				Sites []struct {
+					Leaks []map[string]any `json:"leaks"`
+				} `json:"sites"`
+			}
+			if err := json.Unmarshal(content, &report); err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Sites) != 1 {
+				t.Fatalf("report of %d site(s), want 1: %s", len(report.Sites), content)
+			}
+			leaks := report.Sites[0].Leaks
+			if leaks == nil {
+				t.Fatalf("leaks of the site are null, want a list: %s", content)
+			}
+			// only the fields telling what leaked are compared
+			for _, leak := range leaks {
+				leak["file"] = filepath.Base(leak["file"].(string))
+				delete(leak, "url")
+				delete(leak, "page")
+			}
+			got, _ := json.Marshal(leaks)
+			if string(got) != test.want {
+				t.Errorf("leaks %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func isLinkNode(currentNode *html.Node) bool {
+	return currentNode.Type == html.ElementNode && (currentNode.DataAtom == atom.A || currentNode.DataAtom == atom.Area)
+}
+
+// extract_linked_images yields the images that <a href> and <area href>
+// point to directly, like the full-size photo behind a gallery thumbnail.
+// Both are resolved against the page.
+func extract_linked_images(currentNode *html.Node, spider *Spider, page string) []Candidate {
+	if !isLinkNode(currentNode) {
+		return nil
+	}
+	href := getAttr(currentNode, "href")
+	if isDataURI(href) {
+		return []Candidate{{Kind: candidateImage, URL: href, Source: currentNode.Data}}
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+	absolutePath, err := createAbsolutePathIfIsNot(base, href)
+	if err != nil || !isValidURL(absolutePath) || !isImageLink(spider, absolutePath) {
+		return nil
+	}
+
+	candidate := Candidate{Kind: candidateImage, URL: absolutePath, Source: currentNode.Data, Typed: true}
+	if thumbnail := anchorThumbnail(currentNode); thumbnail != "" {
+		if thumbnailUrl, err := createAbsolutePathIfIsNot(base, thumbnail); err == nil {
+			candidate.Thumbnail = thumbnailUrl
+		}
+	}
+	return []Candidate{candidate}
+}
+
+// extract_links yields the pages that <a href> and <area href> point to.
+func extract_links(currentNode *html.Node, spider *Spider, page string) []Candidate {
+	if !isLinkNode(currentNode) {
+		return nil
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+	for _, a := range currentNode.Attr {
+		if a.Key != "href" {
+			continue
+		}
+		absolutePath, err := createAbsolutePathIfIsNot(base, a.Val)
+		if err != nil || !isValidURL(absolutePath) {
+			continue
+		}
+		// images behind links are saved by extract_linked_images
+		if isImageLink(spider, absolutePath) {
+			return nil
+		}
+		return []Candidate{{Kind: candidateLink, URL: absolutePath, Source: currentNode.Data}}
+	}
+	return nil
+}
+
+// isImageLink tells if a link targets an image, from its extension or, with
+// -head, from the Content-Type of a HEAD request. Answers are cached.
+func isImageLink(spider *Spider, absolutePath string) bool {
+	if isImage, ok := spider.image_links[absolutePath]; ok {
+		return isImage
+	}
+
+	isImage := slices.Contains(spider.valid_ext, imageExt(absolutePath))
+	if !isImage && spider.headProbe {
+		isImage = headIsImage(spider, absolutePath)
+	}
+	spider.image_links[absolutePath] = isImage
+	return isImage
+}
+
+func headIsImage(spider *Spider, absolutePath string) bool {
+	resp, err := spider.client.Head(absolutePath)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return false
+	}
+	return slices.Contains(spider.valid_ext, mediaTypeExtension(mediaType))
+}
+
+// anchorThumbnail returns the src of the first <img> inside an anchor.
+func anchorThumbnail(anchor *html.Node) string {
+	for n := range anchor.Descendants() {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			if src := getAttr(n, "src"); src != "" {
+				return src
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLinksResolvedAgainstPage(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/": []byte(`<html><body><a href="/gallery/index.html">gallery</a></body></html>`),
+		"/gallery/index.html": []byte(`<html><body>
+<a href="full/a.png"><img src="thumbs/a.png"></a>
+<a href="more.html">more</a>
+</body></html>`),
+		"/gallery/more.html":    []byte(`<html><body><map><area href="full/b.png"></map></body></html>`),
+		"/gallery/full/a.png":   testPNG(t, 0),
+		"/gallery/full/b.png":   testPNG(t, 100),
+		"/gallery/thumbs/a.png": testPNG(t, 50),
+	})
+
+	entries := testCrawl(t, server.URL+"/", t.TempDir(), nil)
+	type linked struct{ URL, Thumbnail, Status string }
+	var got []linked
+	for _, entry := range entries {
+		if entry.Source == "a" || entry.Source == "area" {
+			got = append(got, linked{strings.TrimPrefix(entry.URL, server.URL), strings.TrimPrefix(entry.Thumbnail, server.URL), entry.Status})
+		}
+	}
+	want := []linked{
+		{"/gallery/full/a.png", "/gallery/thumbs/a.png", statusSaved},
+		{"/gallery/full/b.png", "", statusSaved},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("linked images %+v, want %+v", got, want)
+	}
+}
@@ -3,65 +3,283 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
 )
 
 type Spider struct {
-	rFlag       bool
-	lFlag       int
-	pFlag       string
-	baseUrl     *url.URL
-	valid_ext   []string
-	visited_url map[string]bool
-	banner      string
+	rFlag        bool
+	lFlag        int
+	pFlag        string
+	baseUrl      *url.URL
+	valid_ext    []string
+	visited_url  map[string]bool
+	banner       string
+	client       *http.Client
+	warc         *WarcWriter
+	localRoot    string
+	har          *harTransport
+	recordDir    string
+	userAgent    string
+	timeout      time.Duration
+	delay        time.Duration
+	replayDir    string
+	inlineSvg    bool
+	seen_hash    map[string]string
+	image_links  map[string]bool
+	headProbe    bool
+	endpoints    bool
+	originals    bool
+	filter       ImageFilter
+	nearDup      bool
+	nearDistance int
+	nearKeepAll  bool
+	perceptual   []perceptualImage
+	scorpionBin  string
+	stripMeta    bool
+	leakReport   string
+	leakSites    map[string]*leakSite
+	graph        *CrawlGraph
+	stats        *seedStats
+	progress     *Progress
+	events       *Events
+	gallery      *Gallery
+	traps        *TrapGuard
+	manifest     *Manifest
+	index        *ImageIndex
+	evidence     *Evidence
+	throttle     *Throttle
 }
 
 func printHelp() {
-	fmt.Println(`
+	fmt.Print(`
 Spider - Minimal Scrapper of images
 
 USAGE:
-  spider [-rlp] URL
+  spider [-rlp] URL...
+  spider [-rlp] -seeds FILE
+  spider [-rlp] DIRECTORY | file://PATH
+  spider [-p] CAPTURE.har
+  spider -config FILE [OPTIONS] [URL...]
+  spider watch [-interval DURATION] [-runs N] [-webhook URL] [OPTIONS] URL...
+  spider verify [-key PUBLIC_KEY.pem] DIRECTORY
 
 OPTIONS:
   -r        recursively downloads the images in a URL received as a parameter
   -l        indicates the maximum depth level of the recursive download.(default 5)
   -p        indicates the path where the downloaded files will be saved.(default ./data/ will be used).
+            With several seeds, each one gets a subdirectory named after its host
+  -seeds    read more seed URLs from the given file, one per line, # starts a comment
+  -root     directory served as the root of the sites saved on disk, for the links starting with /.
+            (default the directory given, or the one of the file given)
+  -config   read the options from a JSON file, the options given on the command line override it
+  -print-config  print the configuration merged from -config and the command line as JSON, and exit
+  -user-agent  User-Agent header sent with every request.(default Go-http-client/1.1)
+  -timeout  maximum time of a request, body included.(default 0 = no limit)
+  -delay    minimum time between two requests.(default 0)
+  -limit-rate  maximum download rate in bytes per second of all the hosts together, like 500K or 2M.(default no limit)
+  -limit-rate-host  maximum download rate in bytes per second of each host.(default no limit)
+  -warc     write every request and response as WARC/1.1 records in the given directory
+  -warc-size  size in MB after which a new WARC file is started.(default 1024)
+  -svg      also save the inline <svg> elements of the pages as .svg files
+  -head     send a HEAD request to links without image extension to find the ones serving images
+  -json-endpoints  with -r, crawl the JSON endpoints named by the scripts of the pages for image URLs.(default true)
+  -originals  try first the original of resized images (WordPress, Shopify, Cloudinary, imgix, ?w= queries)
+  -min-width, -max-width, -min-height, -max-height
+            keep only the images whose dimensions in pixels are within these limits
+  -min-size, -max-size
+            keep only the images whose size in bytes is within these limits
+  -formats, -exclude-formats
+            comma separated list of image formats to download or to skip, named as in FORMATS (ex: jpeg,png,webp).(default all)
+  -min-ratio, -max-ratio
+            keep only the images whose width/height ratio is within these limits
+  -near-dup group the visually identical images (re-encoded, resized) and keep only the largest of each group
+  -near-distance  maximum number of different bits between the perceptual hash of an image and the one of
+            the image kept in its group.(default 6)
+  -near-keep-all  with -near-dup, report the groups but keep every file
+  -scorpion scan every downloaded image with Scorpion and write a per-site report of the metadata leaks
+            (GPS, camera serials, authors, software, timestamps)
+  -strip-metadata  store only copies of the images cleaned of their metadata by Scorpion (JPEG, PNG, GIF, BMP),
+            the other formats are rejected and the manifest lists the leak categories removed, not with -warc or -record
+  -scorpion-bin  path of the scorpion program.(default scorpion, searched in the PATH)
+  -leaks    path of the leak report.(default <-p>/leaks.json)
+  -max-url-length  skip the links longer than this number of characters.(default 0 = no limit, 2048 is a good limit)
+  -max-path-depth  skip the links with more path segments.(default 0 = no limit, 20 is a good limit)
+  -max-repeats     skip the links repeating a block of path segments this many times, like /a/b/a/b/a/b.(default 0 = no limit, 3 is a good limit)
+  -max-query-variants  maximum number of distinct query strings crawled per path.(default 0 = no limit, 100 is a good limit)
+  -pattern-budget  maximum number of pages crawled per URL pattern, numbers and query values ignored.(default 0 = no limit, 1000 is a good limit)
+  -json     write one JSON object per event on stdout (page_fetched, image_saved, image_skipped, error, summary),
+            the messages go to stderr and the banner is not shown
+  -progress live status line, periodic PROGRESS lines or nothing: live, log or off.(default live on a terminal, log otherwise)
+  -progress-interval  time between two PROGRESS lines in log mode.(default 10s)
+  -report   write a self-contained HTML gallery of the crawl results in the given file
+  -graph    export the crawl graph of pages and images to PREFIX.dot, PREFIX.graphml and PREFIX.json
+  -manifest write a JSON line per image (url, page, file, sha256, status) in the given file
+  -record   save every HTTP exchange in the given directory
+  -replay   serve HTTP exchanges from a directory filled by -record, without network
+  -evidence record the time, IP, TLS certificate, headers and SHA-256 of every exchange and saved file in
+            <-p>/evidence.jsonl, signed with the given Ed25519 private key (PEM, openssl genpkey -algorithm ed25519)
   -h        show the help
 
-FORMATS SUPPORTED:
-  JPEG/JPG  
-  PNG       
-  BMP       
-  GIF       
+WATCH:
+  spider watch crawls again every interval and compares each crawl to the one before: the new, removed and changed
+  images and pages are written to <-p>/diffs/diff-TIME.json, the index of the last crawl is kept in <-p>/index.json
+  -interval time between two crawls.(default 1h)
+  -runs     number of crawls before stopping.(default 0 = until interrupted)
+  -webhook  POST each diff having changes as JSON to the given URL
+
+VERIFY:
+  spider verify checks the signature of <DIRECTORY>/evidence.jsonl and the SHA-256 of every file it lists
+  -key      Ed25519 public key (PEM) expected to have signed the manifest.(default the key stored with it)
 
+`)
+	fmt.Print(formatsHelp())
+	fmt.Println(`
 EXEMPLES:
   spider  -r http://httpbin.org/links/10/0   # Scrapp Recursively with depth of 5 by default the images on the site
   spider  -r -l 4 [URL]                      # Scrapp Recursively with depth of 4 the images on the site
-  spider  -r -l 3 -p ./test/ [URL]           # Recursively retrieves images from the site with depth of 3 and puts them in the ./test folder`)
+  spider  -r -l 3 -p ./test/ [URL]           # Recursively retrieves images from the site with depth of 3 and puts them in the ./test folder
+  spider  -r -seeds domains.txt [URL]...     # Crawl several sites, each in its own folder under ./data/
+  spider  -config crawl.json -l 2            # Crawl with the options of crawl.json, the depth set to 2
+  spider  -r ./site-dump/                    # Crawl a site saved on disk, without network
+  spider  -r -root ./dump/ ./dump/blog/a.html # Crawl from a page of a site saved on disk, / being ./dump/
+  spider  capture.har                        # Extract the images and pages of a browser HAR export, without network
+  spider  -r -record ./cassette/ [URL]       # Crawl and keep every exchange to replay it later
+  spider  -r -replay ./cassette/ [URL]       # Reproduce exactly the recorded crawl
+  spider  watch -interval 6h -r [URL]        # Report the photos published or removed on the site every 6 hours
+  spider  -r -evidence key.pem [URL]         # Crawl and keep a signed chain of custody of what was collected
+  spider  verify -key public.pem ./data/     # Check that nothing collected was modified since`)
 }
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verifyCommand(os.Args[2:]))
+	}
+
 	var spider Spider
 
 	helpFlag := flag.Bool("h", false, "show help")
+	seedsFlag := flag.String("seeds", "", "read more seed URLs from the given file, one per line, # starts a comment")
+	rootFlag := flag.String("root", "", "directory served as the root of the sites saved on disk, for the links starting with / (default the directory given, or the one of the file given)")
+	configFlag := flag.String("config", "", "read the options from a JSON file, the options given on the command line override it")
+	printConfigFlag := flag.Bool("print-config", false, "print the configuration merged from -config and the command line as JSON, and exit")
+	userAgentFlag := flag.String("user-agent", "", "User-Agent header sent with every request (default Go-http-client/1.1)")
+	timeoutFlag := flag.Duration("timeout", 0, "maximum time of a request, body included (0 = no limit)")
+	delayFlag := flag.Duration("delay", 0, "minimum time between two requests")
+	limitRateFlag := flag.String("limit-rate", "", "maximum download rate in bytes per second of all the hosts together, like 500K or 2M")
+	limitRateHostFlag := flag.String("limit-rate-host", "", "maximum download rate in bytes per second of each host")
 	rFlag := flag.Bool("r", false, "recursively downloads the images in a URL received as a parameter")
 	lFlag := flag.Int("l", 5, "indicates the maximum depth level of the recursive download.If not indicated, it will be 5")
 	pFlag := flag.String("p", "./data/", "indicates the path where the downloaded files will be saved.If not specified, ./data/ will be used.")
+	warcFlag := flag.String("warc", "", "write every request and response as WARC/1.1 records in the given directory")
+	warcSizeFlag := flag.Int64("warc-size", 1024, "size in MB after which a new WARC file is started")
+	svgFlag := flag.Bool("svg", false, "also save the inline <svg> elements of the pages as .svg files")
+	headFlag := flag.Bool("head", false, "send a HEAD request to links without image extension to find the ones serving images")
+	jsonEndpointsFlag := flag.Bool("json-endpoints", true, "with -r, crawl the JSON endpoints named by the scripts of the pages for image URLs")
+	originalsFlag := flag.Bool("originals", false, "try first the original of resized images (WordPress, Shopify, Cloudinary, imgix, ?w= queries)")
+	minWidthFlag := flag.Int("min-width", 0, "minimum width in pixels of the images to keep")
+	maxWidthFlag := flag.Int("max-width", 0, "maximum width in pixels of the images to keep")
+	minHeightFlag := flag.Int("min-height", 0, "minimum height in pixels of the images to keep")
+	maxHeightFlag := flag.Int("max-height", 0, "maximum height in pixels of the images to keep")
+	minSizeFlag := flag.Int64("min-size", 0, "minimum size in bytes of the images to keep")
+	maxSizeFlag := flag.Int64("max-size", 0, "maximum size in bytes of the images to keep")
+	formatsFlag := flag.String("formats", "", "comma separated list of image formats to keep")
+	excludeFormatsFlag := flag.String("exclude-formats", "", "comma separated list of image formats to skip")
+	minRatioFlag := flag.Float64("min-ratio", 0, "minimum width/height ratio of the images to keep")
+	maxRatioFlag := flag.Float64("max-ratio", 0, "maximum width/height ratio of the images to keep")
+	nearDupFlag := flag.Bool("near-dup", false, "group the visually identical images and keep only the largest of each group")
+	nearDistanceFlag := flag.Int("near-distance", 6, "maximum number of different bits between the perceptual hash of an image and the one of the image kept in its group")
+	nearKeepAllFlag := flag.Bool("near-keep-all", false, "with -near-dup, report the groups but keep every file")
+	scorpionFlag := flag.Bool("scorpion", false, "scan every downloaded image with Scorpion and write a per-site report of the metadata leaks")
+	scorpionBinFlag := flag.String("scorpion-bin", "scorpion", "path of the scorpion program")
+	stripMetadataFlag := flag.Bool("strip-metadata", false, "store only copies of the images cleaned of their metadata by Scorpion")
+	leaksFlag := flag.String("leaks", "", "path of the leak report (default <-p>/leaks.json)")
+	maxUrlLengthFlag := flag.Int("max-url-length", 0, "skip the links longer than this number of characters (0 = no limit)")
+	maxPathDepthFlag := flag.Int("max-path-depth", 0, "skip the links with more path segments (0 = no limit)")
+	maxRepeatsFlag := flag.Int("max-repeats", 0, "skip the links repeating a block of path segments this many times, like /a/b/a/b/a/b (0 = no limit)")
+	maxQueryVariantsFlag := flag.Int("max-query-variants", 0, "maximum number of distinct query strings crawled per path (0 = no limit)")
+	patternBudgetFlag := flag.Int("pattern-budget", 0, "maximum number of pages crawled per URL pattern, numbers and query values ignored (0 = no limit)")
+	jsonFlag := flag.Bool("json", false, "write one JSON object per event on stdout, the messages go to stderr")
+	progressFlag := flag.String("progress", "", "live, log or off (default live on a terminal, log otherwise)")
+	progressIntervalFlag := flag.Duration("progress-interval", 10*time.Second, "time between two PROGRESS lines in log mode")
+	reportFlag := flag.String("report", "", "write a self-contained HTML gallery of the crawl results in the given file")
+	graphFlag := flag.String("graph", "", "export the crawl graph of pages and images to PREFIX.dot, PREFIX.graphml and PREFIX.json")
+	manifestFlag := flag.String("manifest", "", "write a JSON line per image (url, page, file, sha256, status) in the given file")
+	recordFlag := flag.String("record", "", "save every HTTP exchange in the given directory")
+	replayFlag := flag.String("replay", "", "serve HTTP exchanges from a directory filled by -record, without network")
+	intervalFlag := flag.Duration("interval", time.Hour, "with watch, time between two crawls")
+	runsFlag := flag.Int("runs", 0, "with watch, number of crawls before stopping (0 = until interrupted)")
+	webhookFlag := flag.String("webhook", "", "with watch, POST each diff having changes as JSON to the given URL")
+	evidenceFlag := flag.String("evidence", "", "record a chain of custody of the crawl in <-p>/evidence.jsonl, signed with the given Ed25519 private key (PEM)")
 
-	flag.Parse()
+	args := os.Args[1:]
+	watchMode := len(args) > 0 && args[0] == "watch"
+	if watchMode {
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 	if *helpFlag {
 		printHelp()
 		return
 	}
 
-	if flag.NArg() != 1 {
+	var configSeeds []string
+	if *configFlag != "" {
+		var err error
+		configSeeds, err = loadConfig(*configFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	// seeds given on the command line replace the ones of the file
+	if flag.NArg() > 0 {
+		configSeeds = nil
+	}
+	if *printConfigFlag {
+		if err := printConfig(append(configSeeds, flag.Args()...)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *jsonFlag {
+		spider.events = newEvents(os.Stdout)
+		os.Stdout = os.Stderr
+	}
+
+	seedArgs := append(configSeeds, flag.Args()...)
+	if *seedsFlag != "" {
+		fileSeeds, err := readSeedFile(*seedsFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		seedArgs = append(seedArgs, fileSeeds...)
+	}
+	if len(seedArgs) == 0 {
 		fmt.Println("Url is required")
 		os.Exit(1)
 	}
 
+	switch *progressFlag {
+	case "", progressLive, progressLog, progressOff:
+	default:
+		fmt.Println("-progress must be live, log or off")
+		os.Exit(1)
+	}
+
+	if *recordFlag != "" && *replayFlag != "" {
+		fmt.Println("-record and -replay can't be used together")
+		os.Exit(1)
+	}
+
 	spider.banner = ` █████                          █████       ███                               ████                                                                                
 ░░███                          ░░███       ░░░                               ░░███                                                                                
  ░███         ██████    ██████  ░███████   ████   ███████ ████████    ██████  ░███      █████   ██████  ████████   ██████   ████████  ████████   ██████  ████████ 
@@ -74,28 +292,190 @@ func main() {
                                                 ░░██████                                                                    █████     █████                       
                                                  ░░░░░░                                                                    ░░░░░     ░░░░░                        `
 
-	url := flag.Args()[0]
-
 	spider.rFlag = *rFlag
 	spider.lFlag = *lFlag
 	spider.pFlag = *pFlag
-	spider.valid_ext = []string{".jpg", ".jpeg", ".bmp", ".svg", ".gif", ".png"}
-
-	err := os.MkdirAll(*pFlag, 0755)
+	valid_ext, err := acceptedExtensions(parseFormatList(*formatsFlag), parseFormatList(*excludeFormatsFlag))
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	spider.valid_ext = valid_ext
 
-	baseUrl, err := extractBaseUrl(url)
+	err = os.MkdirAll(*pFlag, 0755)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	spider.baseUrl = baseUrl
-	spider.visited_url = make(map[string]bool)
-	spider.visited_url[url] = true
 
-	fmt.Println(spider.banner)
-	explore_body(&spider, url, 1)
+	seeds := prepareSeeds(seedArgs, *pFlag, *rootFlag)
+	if len(seeds) == 0 {
+		os.Exit(1)
+	}
+	spider.inlineSvg = *svgFlag
+	spider.headProbe = *headFlag
+	spider.endpoints = *jsonEndpointsFlag
+	spider.originals = *originalsFlag
+	if *stripMetadataFlag && (*warcFlag != "" || *recordFlag != "") {
+		fmt.Println("-strip-metadata can't be used with -warc or -record, they keep the images as downloaded, metadata included")
+		os.Exit(1)
+	}
+	if *scorpionFlag || *stripMetadataFlag {
+		spider.scorpionBin, err = exec.LookPath(*scorpionBinFlag)
+		if err != nil {
+			fmt.Println("scorpion not found, build it in ../Scorpion or give its path with -scorpion-bin:", err)
+			os.Exit(1)
+		}
+	}
+	spider.stripMeta = *stripMetadataFlag
+	if *scorpionFlag {
+		spider.leakReport = *leaksFlag
+		if spider.leakReport == "" {
+			spider.leakReport = filepath.Join(*pFlag, "leaks.json")
+		}
+	}
+	spider.nearDup = *nearDupFlag
+	spider.nearDistance = *nearDistanceFlag
+	spider.nearKeepAll = *nearKeepAllFlag
+	spider.filter = ImageFilter{
+		minWidth:       *minWidthFlag,
+		maxWidth:       *maxWidthFlag,
+		minHeight:      *minHeightFlag,
+		maxHeight:      *maxHeightFlag,
+		minSize:        *minSizeFlag,
+		maxSize:        *maxSizeFlag,
+		formats:        parseFormatList(*formatsFlag),
+		excludeFormats: parseFormatList(*excludeFormatsFlag),
+		minRatio:       *minRatioFlag,
+		maxRatio:       *maxRatioFlag,
+	}
+
+	if *manifestFlag != "" {
+		spider.manifest, err = newManifest(*manifestFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer spider.manifest.Close()
+	}
+
+	if *warcFlag != "" {
+		spider.warc, err = newWarcWriter(*warcFlag, *warcSizeFlag*1024*1024)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer spider.warc.Close()
+	}
+	if *evidenceFlag != "" {
+		spider.evidence, err = newEvidence(*evidenceFlag, *pFlag)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer spider.evidence.Close()
+	}
+	spider.recordDir = *recordFlag
+	spider.replayDir = *replayFlag
+	spider.userAgent = *userAgentFlag
+	spider.timeout = *timeoutFlag
+	spider.delay = *delayFlag
+	limitRate, err := parseRate(*limitRateFlag)
+	if err != nil {
+		fmt.Println("-limit-rate:", err)
+		os.Exit(1)
+	}
+	limitRateHost, err := parseRate(*limitRateHostFlag)
+	if err != nil {
+		fmt.Println("-limit-rate-host:", err)
+		os.Exit(1)
+	}
+	spider.throttle = newThrottle(limitRate, limitRateHost)
+
+	if spider.events == nil {
+		fmt.Println(spider.banner)
+	}
+	// everything a crawl found starts empty again for each crawl of watch
+	crawl := func() {
+		spider.seen_hash = make(map[string]string)
+		spider.image_links = make(map[string]bool)
+		spider.perceptual = nil
+		if spider.leakReport != "" {
+			spider.leakSites = make(map[string]*leakSite)
+		}
+		spider.traps = newTrapGuard()
+		spider.traps.maxUrlLength = *maxUrlLengthFlag
+		spider.traps.maxPathDepth = *maxPathDepthFlag
+		spider.traps.maxRepeats = *maxRepeatsFlag
+		spider.traps.maxQueryVariants = *maxQueryVariantsFlag
+		spider.traps.patternBudget = *patternBudgetFlag
+		if *graphFlag != "" {
+			spider.graph = newCrawlGraph()
+		}
+		if *reportFlag != "" {
+			spider.gallery = newGallery()
+		}
+		for _, seed := range seeds {
+			seed.stats = seedStats{}
+		}
+
+		spider.progress = newProgress(*progressFlag, *progressIntervalFlag, spider.throttle)
+		if err := spider.progress.Start(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, seed := range seeds {
+			if err := crawlSeed(&spider, seed); err != nil {
+				fmt.Println(seed.arg+":", err)
+			}
+		}
+		spider.progress.Stop()
+		spider.traps.Report()
+		reportNearDuplicates(&spider)
+		writeLeakReport(&spider)
+		if err := spider.graph.Export(*graphFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if spider.graph != nil {
+			fmt.Println("GRAPH:", *graphFlag+".{dot,graphml,json}")
+		}
+		if err := spider.gallery.Write(*reportFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if spider.gallery != nil {
+			fmt.Println("REPORT:", *reportFlag)
+		}
+		if err := spider.evidence.Sign(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if spider.evidence != nil {
+			fmt.Println("EVIDENCE:", spider.evidence.path)
+		}
+		printSeedSummary(seeds)
+		spider.progress.PrintSummary()
+		spider.events.Summary(seeds, spider.progress)
+	}
+
+	if !watchMode {
+		crawl()
+		return
+	}
+	seedUrls := make([]string, len(seeds))
+	for i, seed := range seeds {
+		seedUrls[i] = seed.url
+	}
+	err = watch(&spider, crawl, watchOptions{
+		dir:      *pFlag,
+		interval: *intervalFlag,
+		runs:     *runsFlag,
+		webhook:  *webhookFlag,
+		seeds:    seedUrls,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// ManifestEntry is one line of the manifest: what happened to one image.
+type ManifestEntry struct {
+	URL         string `json:"url"`
+	Page        string `json:"page,omitempty"`
+	Source      string `json:"source"`
+	Thumbnail   string `json:"thumbnail,omitempty"`
+	VariantOf   string `json:"variant_of,omitempty"`
+	Rewriter    string `json:"rewriter,omitempty"`
+	File        string `json:"file,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// leak categories of the metadata removed by -strip-metadata
+	MetadataRemoved []string `json:"metadata_removed,omitempty"`
+}
+
+const (
+	statusSaved     = "saved"
+	statusDuplicate = "duplicate"
+	statusError     = "error"
+	statusRejected  = "rejected"
+	// written at the end of the crawl, after the "saved" line of the image
+	statusNearDuplicate = "near_duplicate"
+)
+
+// addEntry records what happened to an image in the manifest, the gallery
+// report, the crawl statistics, the event stream, the watch index and the
+// evidence manifest.
+func addEntry(spider *Spider, entry ManifestEntry) {
+	spider.manifest.Add(entry)
+	spider.index.Image(entry)
+	spider.evidence.Image(entry)
+	spider.gallery.Add(entry)
+	spider.stats.count(entry.Status)
+	spider.progress.Image(entry)
+	spider.events.Image(entry)
+}
+
+// Manifest writes entries as JSON lines. A nil *Manifest discards them.
+type Manifest struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newManifest(manifestPath string) (*Manifest, error) {
+	f, err := os.Create(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (m *Manifest) Add(entry ManifestEntry) {
+	if m == nil {
+		return
+	}
+	m.enc.Encode(entry)
+}
+
+func (m *Manifest) Close() error {
+	if m == nil {
+		return nil
+	}
+	return m.file.Close()
+}
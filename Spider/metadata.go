@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var metaImageProperties = []string{
+	"og:image",
+	"og:image:url",
+	"og:image:secure_url",
+	"twitter:image",
+	"twitter:image:src",
+}
+
+var linkImageRels = []string{
+	"icon",
+	"apple-touch-icon",
+	"apple-touch-icon-precomposed",
+	"mask-icon",
+	"image_src",
+}
+
+// schema.org properties holding an image URL, an ImageObject or a list of them
+var jsonLdImageKeys = []string{"image", "logo", "thumbnailUrl", "contentUrl", "photo", "primaryImageOfPage"}
+
+// extract_meta_images yields the images a page only references through its
+// metadata: Open Graph and Twitter cards, icons, the web app manifest and
+// schema.org JSON-LD. Relative URLs are resolved against the page.
+func extract_meta_images(currentNode *html.Node, spider *Spider, page string) []Candidate {
+	if currentNode.Type != html.ElementNode {
+		return nil
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+	var candidates []Candidate
+
+	switch currentNode.DataAtom {
+	case atom.Meta:
+		property := strings.ToLower(getAttr(currentNode, "property"))
+		if property == "" {
+			property = strings.ToLower(getAttr(currentNode, "name"))
+		}
+		if slices.Contains(metaImageProperties, property) {
+			candidates = appendMetaImage(candidates, base, getAttr(currentNode, "content"), property)
+		}
+
+	case atom.Link:
+		href := getAttr(currentNode, "href")
+		for _, rel := range strings.Fields(strings.ToLower(getAttr(currentNode, "rel"))) {
+			if rel == "manifest" {
+				candidates = append(candidates, manifest_icons(spider, base, href)...)
+				break
+			}
+			if slices.Contains(linkImageRels, rel) {
+				candidates = appendMetaImage(candidates, base, href, "link:"+rel)
+				break
+			}
+		}
+
+	case atom.Script:
+		if strings.ToLower(getAttr(currentNode, "type")) != "application/ld+json" || currentNode.FirstChild == nil {
+			return nil
+		}
+		var data any
+		if err := json.Unmarshal([]byte(currentNode.FirstChild.Data), &data); err != nil {
+			return nil
+		}
+		for _, img := range jsonLdImages(data, false) {
+			candidates = appendMetaImage(candidates, base, img, "json-ld")
+		}
+	}
+	return candidates
+}
+
+// appendMetaImage resolves an image URL found in metadata. The metadata
+// already says it is an image, so URLs without extension are kept.
+func appendMetaImage(candidates []Candidate, base *url.URL, value string, source string) []Candidate {
+	if isDataURI(value) {
+		return append(candidates, Candidate{Kind: candidateImage, URL: value, Source: source})
+	}
+	absolutePath, err := createAbsolutePathIfIsNot(base, value)
+	if err != nil {
+		return candidates
+	}
+	return append(candidates, Candidate{Kind: candidateImage, URL: absolutePath, Source: source, Typed: true})
+}
+
+// manifest_icons fetches a web app manifest once per crawl and yields the
+// icons it lists, resolved against the manifest URL.
+func manifest_icons(spider *Spider, page *url.URL, href string) []Candidate {
+	manifestUrl, err := createAbsolutePathIfIsNot(page, href)
+	if err != nil || spider.visited_url[manifestUrl] {
+		return nil
+	}
+	spider.visited_url[manifestUrl] = true
+
+	resp, err := spider.client.Get(manifestUrl)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var manifest struct {
+		Icons []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+		Screenshots []struct {
+			Src string `json:"src"`
+		} `json:"screenshots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil
+	}
+
+	base, err := url.Parse(manifestUrl)
+	if err != nil {
+		return nil
+	}
+	var candidates []Candidate
+	for _, icon := range manifest.Icons {
+		candidates = appendMetaImage(candidates, base, icon.Src, "manifest:icon")
+	}
+	for _, screenshot := range manifest.Screenshots {
+		candidates = appendMetaImage(candidates, base, screenshot.Src, "manifest:screenshot")
+	}
+	return candidates
+}
+
+// jsonLdImages walks a JSON-LD document and returns the image URLs found in
+// image-like properties. inImage is true while inside such a property, where
+// plain strings and the url/contentUrl of ImageObjects are images.
+func jsonLdImages(data any, inImage bool) []string {
+	var images []string
+	switch v := data.(type) {
+	case string:
+		if inImage {
+			images = append(images, v)
+		}
+	case []any:
+		for _, item := range v {
+			images = append(images, jsonLdImages(item, inImage)...)
+		}
+	case map[string]any:
+		isImageObject := inImage || jsonLdHasType(v["@type"], "ImageObject")
+		for key, value := range v {
+			switch {
+			case slices.Contains(jsonLdImageKeys, key):
+				images = append(images, jsonLdImages(value, true)...)
+			case key == "url" && isImageObject:
+				images = append(images, jsonLdImages(value, true)...)
+			case key != "@context" && key != "@id" && key != "url":
+				images = append(images, jsonLdImages(value, false)...)
+			}
+		}
+	}
+	return images
+}
+
+// jsonLdHasType tells if a JSON-LD @type, a string or an array of them, is
+// or includes name.
+func jsonLdHasType(value any, name string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == name
+	case []any:
+		return slices.Contains(v, any(name))
+	}
+	return false
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// imageExt is the lower-cased extension of the URL path, ignoring the query.
+func imageExt(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(path.Ext(u.Path))
+}
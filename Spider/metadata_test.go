@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJsonLdImages(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "image property",
+			doc:  `{"@type": "Product", "image": "/a.jpg", "url": "/product"}`,
+			want: []string{"/a.jpg"},
+		},
+		{
+			name: "image array",
+			doc:  `{"@type": "Product", "image": ["/a.jpg", "/b.jpg"]}`,
+			want: []string{"/a.jpg", "/b.jpg"},
+		},
+		{
+			name: "ImageObject in an image property",
+			doc:  `{"@type": "Article", "image": {"@type": "ImageObject", "url": "/a.jpg", "width": 800}}`,
+			want: []string{"/a.jpg"},
+		},
+		{
+			name: "ImageObject type",
+			doc:  `{"@graph": [{"@type": "ImageObject", "@id": "/#logo", "url": "/logo.png"}, {"@type": "WebPage", "url": "/page"}]}`,
+			want: []string{"/logo.png"},
+		},
+		{
+			name: "ImageObject in a type array",
+			doc:  `{"@graph": [{"@type": ["ImageObject", "MediaObject"], "contentUrl": "/photo.jpg", "url": "/photo-page.jpg"}]}`,
+			want: []string{"/photo-page.jpg", "/photo.jpg"},
+		},
+		{
+			name: "other types",
+			doc:  `{"@type": ["WebPage", "CollectionPage"], "url": "/page", "name": "Photos"}`,
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data any
+			if err := json.Unmarshal([]byte(test.doc), &data); err != nil {
+				t.Fatal(err)
+			}
+			got := jsonLdImages(data, false)
+			// maps are walked in any order
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("jsonLdImages() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMetadataResolvedAgainstPage(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/": []byte(`<html><body><a href="/blog/post.html">post</a></body></html>`),
+		"/blog/post.html": []byte(`<html><head>
+<meta property="og:image" content="cover.png">
+<link rel="icon" href="icon.png">
+<link rel="manifest" href="app/manifest.json">
+<script type="application/ld+json">{"@type": "Article", "image": "ld.png"}</script>
+</head><body></body></html>`),
+		"/blog/app/manifest.json": []byte(`{"icons": [{"src": "icons/192.png"}]}`),
+		"/blog/cover.png":         testPNG(t, 0),
+		"/blog/icon.png":          testPNG(t, 40),
+		"/blog/ld.png":            testPNG(t, 80),
+		"/blog/app/icons/192.png": testPNG(t, 120),
+	})
+
+	entries := testCrawl(t, server.URL+"/", t.TempDir(), nil)
+	got := make(map[string]string)
+	for _, entry := range entries {
+		got[strings.TrimPrefix(entry.URL, server.URL)] = entry.Status
+	}
+	want := map[string]string{
+		"/blog/cover.png":         statusSaved,
+		"/blog/icon.png":          statusSaved,
+		"/blog/ld.png":            statusSaved,
+		"/blog/app/icons/192.png": statusSaved,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metadata images %v, want %v", got, want)
+	}
+}
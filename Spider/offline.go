@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localSeed turns a local directory, a local file or a file:// URL into the
+// directory served as the root of the offline site and the seed URL to
+// crawl inside it. The root is rootDir when given, so that the links
+// starting with / of the pages in its subdirectories stay in the site, or
+// else the directory given or the one of the file given. ok is false when
+// arg is not a local path.
+func localSeed(arg string, rootDir string) (root string, seedUrl string, ok bool, err error) {
+	localPath := arg
+	if u, err := url.Parse(arg); err == nil && u.Scheme == "file" {
+		localPath = u.Path
+	} else if err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		return "", "", false, nil
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", "", false, nil
+	}
+	abs, err := filepath.Abs(localPath)
+	if err != nil {
+		return "", "", false, nil
+	}
+	root = abs
+	if !info.IsDir() {
+		root = filepath.Dir(abs)
+	}
+	if rootDir != "" {
+		if root, err = filepath.Abs(rootDir); err != nil {
+			return "", "", true, err
+		}
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", true, fmt.Errorf("%s is not inside the root %s", localPath, root)
+	}
+	seed := url.URL{Scheme: "file", Path: "/"}
+	if rel != "." {
+		seed.Path += filepath.ToSlash(rel)
+		if info.IsDir() {
+			seed.Path += "/"
+		}
+	}
+	return root, seed.String(), true, nil
+}
+
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status     int    `json:"status"`
+		StatusText string `json:"statusText"`
+		Headers    []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// harTransport answers requests from a HAR capture and never touches the
+// network. URLs absent from the capture get a 404.
+type harTransport struct {
+	entries map[string]*harEntry
+	pages   []string
+	images  []string
+}
+
+func loadHar(harPath string) (*harTransport, error) {
+	content, err := os.ReadFile(harPath)
+	if err != nil {
+		return nil, err
+	}
+	var har harFile
+	if err := json.Unmarshal(content, &har); err != nil {
+		return nil, fmt.Errorf("%s: invalid HAR: %w", harPath, err)
+	}
+
+	t := &harTransport{entries: make(map[string]*harEntry)}
+	for i := range har.Log.Entries {
+		e := &har.Log.Entries[i]
+		key := e.Request.Method + " " + e.Request.URL
+		if _, exists := t.entries[key]; exists || e.Response.Status != http.StatusOK {
+			continue
+		}
+		t.entries[key] = e
+
+		mime := strings.ToLower(e.Response.Content.MimeType)
+		switch {
+		case strings.HasPrefix(mime, "text/html"), strings.HasPrefix(mime, "application/xhtml"):
+			t.pages = append(t.pages, e.Request.URL)
+		case strings.HasPrefix(mime, "image/"):
+			t.images = append(t.images, e.Request.URL)
+		}
+	}
+	if len(t.entries) == 0 {
+		return nil, errors.New(harPath + ": no usable entry in HAR")
+	}
+	return t, nil
+}
+
+// seed is the URL used as base for scope checks: the first captured page,
+// or the first captured entry when there is no page at all.
+func (t *harTransport) seed() string {
+	if len(t.pages) > 0 {
+		return t.pages[0]
+	}
+	if len(t.images) > 0 {
+		return t.images[0]
+	}
+	for _, e := range t.entries {
+		return e.Request.URL
+	}
+	return ""
+}
+
+func (e *harEntry) body() ([]byte, error) {
+	if e.Response.Content.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(e.Response.Content.Text)
+	}
+	return []byte(e.Response.Content.Text), nil
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+
+	e, ok := t.entries[req.Method+" "+req.URL.String()]
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		return resp, nil
+	}
+
+	body, err := e.body()
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad HAR body: %w", req.URL, err)
+	}
+	for _, h := range e.Response.Headers {
+		// the HAR body is already decoded and de-chunked
+		switch strings.ToLower(h.Name) {
+		case "content-encoding", "content-length", "transfer-encoding":
+			continue
+		}
+		resp.Header.Add(h.Name, h.Value)
+	}
+	if resp.Header.Get("Content-Type") == "" && e.Response.Content.MimeType != "" {
+		resp.Header.Set("Content-Type", e.Response.Content.MimeType)
+	}
+	resp.StatusCode = e.Response.Status
+	resp.Status = fmt.Sprintf("%d %s", e.Response.Status, e.Response.StatusText)
+	resp.ContentLength = int64(len(body))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// localTransport serves files from disk. The file server takes the charset
+// of pages from their extension (always utf-8), drop it so the one of the
+// page itself is used.
+type localTransport struct {
+	next http.RoundTripper
+}
+
+func (t localTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && params["charset"] != "" {
+		resp.Header.Set("Content-Type", mediaType)
+	}
+	return resp, nil
+}
+
+// crawlHar saves every image response of the capture, then explores its HTML
+// pages for links to other captured pages.
+func crawlHar(spider *Spider) {
+	for _, img := range spider.har.images {
+		writeImgFile(spider, imageRef{url: img, source: "har"})
+	}
+	for _, page := range spider.har.pages {
+		spider.visited_url[page] = true
+	}
+	spider.progress.Queued(len(spider.har.pages))
+	for _, page := range spider.har.pages {
+		explore_body(spider, page, 1)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestTree writes files under dir, creating their directories.
+func writeTestTree(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLocalSeed(t *testing.T) {
+	site := t.TempDir()
+	writeTestTree(t, site, map[string][]byte{
+		"index.html":     []byte("<html></html>"),
+		"blog/post.html": []byte("<html></html>"),
+	})
+	outside := t.TempDir()
+
+	tests := []struct {
+		name    string
+		arg     string
+		rootDir string
+		root    string
+		seedUrl string
+		ok      bool
+		wantErr bool
+	}{
+		{"directory", site, "", site, "file:///", true, false},
+		{"file", filepath.Join(site, "blog", "post.html"), "", filepath.Join(site, "blog"), "file:///post.html", true, false},
+		{"file URL", "file://" + filepath.ToSlash(filepath.Join(site, "index.html")), "", site, "file:///index.html", true, false},
+		{"file with root", filepath.Join(site, "blog", "post.html"), site, site, "file:///blog/post.html", true, false},
+		{"directory with root", filepath.Join(site, "blog"), site, site, "file:///blog/", true, false},
+		{"outside the root", filepath.Join(site, "index.html"), outside, "", "", true, true},
+		{"URL", "http://example.com/", "", "", "", false, false},
+		{"missing", filepath.Join(site, "missing.html"), "", "", "", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, seedUrl, ok, err := localSeed(test.arg, test.rootDir)
+			if root != test.root || seedUrl != test.seedUrl || ok != test.ok || (err != nil) != test.wantErr {
+				t.Errorf("localSeed() = %q, %q, %v, %v, want %q, %q, %v, error %v", root, seedUrl, ok, err, test.root, test.seedUrl, test.ok, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestOfflineCrawl(t *testing.T) {
+	site := t.TempDir()
+	writeTestTree(t, site, map[string][]byte{
+		"index.html": []byte(`<html><body><img src="/img/a.png"><a href="blog/post.html">blog</a></body></html>`),
+		"blog/post.html": []byte(`<html><body><img src="/img/b.png">
+<a href="../img/c.png">full size</a><a href="/index.html">home</a></body></html>`),
+		"img/a.png": testPNG(t, 0),
+		"img/b.png": testPNG(t, 80),
+		"img/c.png": testPNG(t, 160),
+	})
+
+	tests := []struct {
+		name string
+		seed string
+		root string
+		want map[string]string
+	}{
+		{
+			name: "directory",
+			seed: site,
+			want: map[string]string{"/img/a.png": statusSaved, "/img/b.png": statusSaved, "/img/c.png": statusSaved},
+		},
+		{
+			name: "page of a subdirectory, with the root",
+			seed: filepath.Join(site, "blog", "post.html"),
+			root: site,
+			want: map[string]string{"/img/a.png": statusSaved, "/img/b.png": statusSaved, "/img/c.png": statusSaved},
+		},
+		{
+			// the directory of the page is the root: /img is not in it
+			name: "page of a subdirectory",
+			seed: filepath.Join(site, "blog", "post.html"),
+			want: map[string]string{"/img/b.png": statusError, "/img/c.png": statusError},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spider := newTestSpider(t)
+			manifestPath := filepath.Join(t.TempDir(), "manifest.jsonl")
+			var err error
+			if spider.manifest, err = newManifest(manifestPath); err != nil {
+				t.Fatal(err)
+			}
+			spider.seen_hash = make(map[string]string)
+			spider.image_links = make(map[string]bool)
+			spider.traps = newTrapGuard()
+			spider.progress = newProgress(progressOff, 0, nil)
+			dir := t.TempDir()
+			seeds := prepareSeeds([]string{test.seed}, dir, test.root)
+			if len(seeds) != 1 {
+				t.Fatalf("invalid seed %s", test.seed)
+			}
+			if err := crawlSeed(spider, seeds[0]); err != nil {
+				t.Fatal(err)
+			}
+			spider.manifest.Close()
+
+			got := make(map[string]string)
+			for _, entry := range readTestManifest(t, manifestPath, dir) {
+				// the first outcome, the pages link back to each other
+				if image := strings.TrimPrefix(entry.URL, "file://"); got[image] == "" {
+					got[image] = entry.Status
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("images %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"slices"
+	"sort"
+)
+
+type perceptualImage struct {
+	entry  ManifestEntry
+	hash   uint64
+	pixels int
+	flat   bool
+	// of the seed the image was found by
+	stats *seedStats
+}
+
+// flatDeviation is the standard deviation of the gray cells of dHash, on the
+// 16-bit scale of color.RGBA, under which an image is of a single colour:
+// about 2 levels out of 255.
+const flatDeviation = 2 * 257
+
+// dHash is the difference hash of an image: the image is reduced to 9x8
+// gray cells and each bit tells if a cell is brighter than its right
+// neighbour. Re-encoded or resized copies of a photo get close hashes. flat
+// tells the images of a single colour, whose hash says nothing of them; a
+// smooth gradient hashes to 0 too but is not flat.
+func dHash(img image.Image) (hash uint64, flat bool) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return 0, true
+	}
+
+	var cells [8][9]float64
+	for cy := 0; cy < 8; cy++ {
+		y0, y1 := bounds.Min.Y+cy*h/8, bounds.Min.Y+(cy+1)*h/8
+		for cx := 0; cx < 9; cx++ {
+			x0, x1 := bounds.Min.X+cx*w/9, bounds.Min.X+(cx+1)*w/9
+			cells[cy][cx] = averageGray(img, x0, y0, max(x1, x0+1), max(y1, y0+1))
+		}
+	}
+
+	var sum, squares float64
+	for cy := 0; cy < 8; cy++ {
+		for cx := 0; cx < 9; cx++ {
+			sum += cells[cy][cx]
+			squares += cells[cy][cx] * cells[cy][cx]
+		}
+		for cx := 0; cx < 8; cx++ {
+			hash <<= 1
+			if cells[cy][cx] > cells[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	mean := sum / 72
+	return hash, squares/72-mean*mean < flatDeviation*flatDeviation
+}
+
+// averageGray samples at most 16x16 points of the rectangle.
+func averageGray(img image.Image, x0, y0, x1, y1 int) float64 {
+	stepX, stepY := max(1, (x1-x0)/16), max(1, (y1-y0)/16)
+	var sum float64
+	n := 0
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+func hashImageFile(filePath string) (perceptualImage, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return perceptualImage{}, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return perceptualImage{}, err
+	}
+	hash, flat := dHash(img)
+	return perceptualImage{hash: hash, flat: flat, pixels: img.Bounds().Dx() * img.Bounds().Dy()}, nil
+}
+
+// addPerceptualHash hashes a stored image for near-duplicate detection.
+// Formats the stdlib can't decode are left out.
+func addPerceptualHash(spider *Spider, entry ManifestEntry) {
+	perceptual, err := hashImageFile(entry.File)
+	if err != nil {
+		return
+	}
+	perceptual.entry = entry
+	perceptual.stats = spider.stats
+	spider.perceptual = append(spider.perceptual, perceptual)
+}
+
+// groupNearDuplicates returns the groups of more than one image, the best
+// one first: most pixels, then largest file. Every other image of a group is
+// within distance bits of the best one, so that no image is removed for
+// looking like an image that merely looks like the kept one. Flat images,
+// of a single colour, are never grouped.
+func groupNearDuplicates(images []perceptualImage, distance int) [][]perceptualImage {
+	sorted := slices.Clone(images)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		if sorted[a].pixels != sorted[b].pixels {
+			return sorted[a].pixels > sorted[b].pixels
+		}
+		return sorted[a].entry.Size > sorted[b].entry.Size
+	})
+
+	grouped := make([]bool, len(sorted))
+	var groups [][]perceptualImage
+	for i, kept := range sorted {
+		if grouped[i] || kept.flat {
+			continue
+		}
+		group := []perceptualImage{kept}
+		for j := i + 1; j < len(sorted); j++ {
+			if !grouped[j] && !sorted[j].flat && bits.OnesCount64(kept.hash^sorted[j].hash) <= distance {
+				grouped[j] = true
+				group = append(group, sorted[j])
+			}
+		}
+		if len(group) > 1 {
+			grouped[i] = true
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// reportNearDuplicates prints the groups of near-duplicates found during the
+// crawl and, unless -near-keep-all, removes all but the best of each group.
+func reportNearDuplicates(spider *Spider) {
+	if !spider.nearDup {
+		return
+	}
+	groups := groupNearDuplicates(spider.perceptual, spider.nearDistance)
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Println("NEAR-DUPLICATES:", len(groups), "group(s)")
+	for i, group := range groups {
+		kept := group[0]
+		fmt.Printf("GROUP %d: KEEP %s (%d px, %d bytes)\n", i+1, kept.entry.File, kept.pixels, kept.entry.Size)
+		for _, other := range group[1:] {
+			distance := bits.OnesCount64(kept.hash ^ other.hash)
+			fmt.Printf("  %s (%d px, %d bytes, distance %d)\n", other.entry.File, other.pixels, other.entry.Size, distance)
+
+			entry := other.entry
+			entry.Status = statusNearDuplicate
+			entry.Reason = fmt.Sprintf("hamming distance %d", distance)
+			entry.DuplicateOf = kept.entry.File
+			if !spider.nearKeepAll {
+				os.Remove(other.entry.File)
+				if spider.leakReport != "" {
+					forgetLeakScan(spider, other.entry)
+				}
+				entry.File = ""
+			}
+			spider.stats = other.stats
+			addEntry(spider, entry)
+		}
+	}
+}
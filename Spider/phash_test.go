@@ -0,0 +1,186 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func perceptual(file string, hash uint64, pixels int) perceptualImage {
+	return perceptualImage{entry: ManifestEntry{File: file}, hash: hash, pixels: pixels}
+}
+
+func flatImage(file string, pixels int) perceptualImage {
+	img := perceptual(file, 0, pixels)
+	img.flat = true
+	return img
+}
+
+func groupFiles(groups [][]perceptualImage) [][]string {
+	var files [][]string
+	for _, group := range groups {
+		var names []string
+		for _, img := range group {
+			names = append(names, img.entry.File)
+		}
+		files = append(files, names)
+	}
+	return files
+}
+
+func TestGroupNearDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		images []perceptualImage
+		want   [][]string
+	}{
+		{
+			name: "best first",
+			images: []perceptualImage{
+				perceptual("small", 0xff00, 10),
+				perceptual("large", 0xff01, 100),
+			},
+			want: [][]string{{"large", "small"}},
+		},
+		{
+			// a is close to b, b to c, but c is 8 bits from a, kept apart
+			name: "not transitive",
+			images: []perceptualImage{
+				perceptual("a", 0xaa0000, 300),
+				perceptual("b", 0xaa000f, 200),
+				perceptual("c", 0xaa00ff, 100),
+			},
+			want: [][]string{{"a", "b"}},
+		},
+		{
+			name: "flat images",
+			images: []perceptualImage{
+				flatImage("white", 100),
+				flatImage("black", 100),
+				flatImage("almost flat", 50),
+			},
+			want: nil,
+		},
+		{
+			// smooth gradients hash to 0 but are compared
+			name: "gradients",
+			images: []perceptualImage{
+				perceptual("gradient", 0, 100),
+				perceptual("smaller gradient", 0, 50),
+				flatImage("flat", 200),
+			},
+			want: [][]string{{"gradient", "smaller gradient"}},
+		},
+		{
+			name: "unrelated",
+			images: []perceptualImage{
+				perceptual("a", 0x00000000ffffffff, 100),
+				perceptual("b", 0xffffffff00000000, 100),
+			},
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := groupFiles(groupNearDuplicates(test.images, 6))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("groupNearDuplicates() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNearDuplicatesLeaveLeakReport(t *testing.T) {
+	dir := t.TempDir()
+	kept := ManifestEntry{URL: "http://a/large.jpg", File: filepath.Join(dir, "large.jpg"), Status: statusSaved}
+	removed := ManifestEntry{URL: "http://a/small.jpg", File: filepath.Join(dir, "small.jpg"), Status: statusSaved}
+	leaking := func(entry ManifestEntry) leakImage {
+		return leakImage{URL: entry.URL, File: entry.File, Categories: map[string]map[string]string{"author": {"Artist": "Jane Roe"}}}
+	}
+	spider := &Spider{
+		nearDup:      true,
+		nearDistance: 6,
+		leakReport:   "leaks.json",
+		leakSites: map[string]*leakSite{
+			"a": {Site: "a", ImagesScanned: 2, ImagesLeaking: 2, Leaks: []leakImage{leaking(kept), leaking(removed)}},
+		},
+		perceptual: []perceptualImage{
+			{entry: kept, hash: 0xff00, pixels: 100},
+			{entry: removed, hash: 0xff01, pixels: 10},
+		},
+		progress: newProgress(progressOff, 0, nil),
+		stats:    &seedStats{},
+	}
+	reportNearDuplicates(spider)
+
+	want := &leakSite{Site: "a", ImagesScanned: 1, ImagesLeaking: 1, Leaks: []leakImage{leaking(kept)}}
+	if got := spider.leakSites["a"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("leak report after near-duplicate removal = %+v, want %+v", got, want)
+	}
+}
+
+func TestNearDuplicatesCountedAsSkipped(t *testing.T) {
+	dir := t.TempDir()
+	seeds := []*Seed{{}, {}}
+	spider := &Spider{
+		nearDup:      true,
+		nearDistance: 6,
+		progress:     newProgress(progressOff, 0, nil),
+	}
+	var images []perceptualImage
+	for i, name := range []string{"large.jpg", "small.jpg"} {
+		spider.stats = &seeds[i].stats
+		entry := ManifestEntry{URL: "http://a/" + name, File: filepath.Join(dir, name), Status: statusSaved, Size: int64(100 * (i + 1))}
+		addEntry(spider, entry)
+		images = append(images, perceptualImage{entry: entry, hash: 0xff00 + uint64(i), pixels: 100 / (i + 1), stats: spider.stats})
+	}
+	spider.perceptual = images
+	reportNearDuplicates(spider)
+
+	summary := spider.progress.Summary()
+	if summary.ImagesSaved != 1 || summary.ImagesSkipped != 1 || summary.Bytes != 100 {
+		t.Errorf("progress after near-duplicate removal: %d saved, %d skipped, %d bytes, want 1, 1, 100",
+			summary.ImagesSaved, summary.ImagesSkipped, summary.Bytes)
+	}
+	want := []seedStats{{saved: 1}, {duplicates: 1}}
+	for i, seed := range seeds {
+		if seed.stats != want[i] {
+			t.Errorf("seed %d stats = %+v, want %+v", i, seed.stats, want[i])
+		}
+	}
+}
+
+func TestDHash(t *testing.T) {
+	gradient := func(rect image.Rectangle, from, to uint8) image.Image {
+		img := image.NewGray(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				shade := int(from) + (int(to)-int(from))*(x-rect.Min.X)/rect.Dx()
+				img.SetGray(x, y, color.Gray{Y: uint8(shade)})
+			}
+		}
+		return img
+	}
+	tests := []struct {
+		name string
+		img  image.Image
+		hash uint64
+		flat bool
+	}{
+		{"white", gradient(image.Rect(0, 0, 64, 64), 255, 255), 0, true},
+		{"single colour", gradient(image.Rect(0, 0, 90, 80), 120, 121), 0, true},
+		{"left to right gradient", gradient(image.Rect(0, 0, 90, 80), 0, 255), 0, false},
+		{"right to left gradient", gradient(image.Rect(0, 0, 90, 80), 255, 0), 1<<64 - 1, false},
+		{"empty", image.NewGray(image.Rectangle{}), 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, flat := dHash(test.img)
+			if hash != test.hash || flat != test.flat {
+				t.Errorf("dHash() = %#x, %v, want %#x, %v", hash, flat, test.hash, test.flat)
+			}
+		})
+	}
+}
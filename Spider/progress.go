@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	progressOff  = "off"
+	progressLive = "live"
+	progressLog  = "log"
+)
+
+type depthStats struct {
+	pages, images int
+}
+
+// Progress counts what the crawl did. On a terminal it keeps a status line
+// under the output, otherwise it prints a PROGRESS line every interval.
+type Progress struct {
+	mu       sync.Mutex
+	mode     string
+	interval time.Duration
+	start    time.Time
+
+	pagesFetched, pagesQueued                int
+	imagesSaved, imagesSkipped, imagesFailed int
+	bytes                                    int64
+	errorClasses                             map[string]int
+	errorCauses                              map[string]int
+	depths                                   map[int]*depthStats
+	depth                                    int
+	throttle                                 *Throttle
+
+	terminal *os.File
+	pipe     *os.File
+	done     chan struct{}
+	stop     chan struct{}
+	drawn    bool
+}
+
+func newProgress(mode string, interval time.Duration, throttle *Throttle) *Progress {
+	if mode == "" {
+		mode = progressLog
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			mode = progressLive
+		}
+	}
+	return &Progress{
+		mode:         mode,
+		interval:     interval,
+		throttle:     throttle,
+		errorClasses: make(map[string]int),
+		errorCauses:  make(map[string]int),
+		depths:       make(map[int]*depthStats),
+	}
+}
+
+// Start begins the display. In live mode the output of the crawl goes
+// through a pipe, so the status line can be cleared before each line and
+// drawn again after it.
+func (p *Progress) Start() error {
+	p.start = time.Now()
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	switch p.mode {
+	case progressLive:
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		p.terminal, p.pipe = os.Stdout, w
+		os.Stdout = w
+		log.SetOutput(progressWriter{p, os.Stderr})
+		go p.forward(r)
+		go p.tick(200*time.Millisecond, p.draw)
+	case progressLog:
+		close(p.done)
+		if p.interval > 0 {
+			go p.tick(p.interval, p.logLine)
+		}
+	default:
+		close(p.done)
+	}
+	return nil
+}
+
+// Stop ends the display and gives the terminal back.
+func (p *Progress) Stop() {
+	close(p.stop)
+	if p.mode == progressLive {
+		os.Stdout = p.terminal
+		log.SetOutput(os.Stderr)
+		p.pipe.Close()
+		<-p.done
+		p.mu.Lock()
+		p.clear()
+		p.mu.Unlock()
+	}
+}
+
+func (p *Progress) forward(r io.Reader) {
+	defer close(p.done)
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			progressWriter{p, p.terminal}.Write(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *Progress) tick(interval time.Duration, f func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			f()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// progressWriter writes above the status line.
+type progressWriter struct {
+	p      *Progress
+	target *os.File
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	w.p.clear()
+	n, err := w.target.Write(b)
+	w.p.draw()
+	return n, err
+}
+
+func (p *Progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.terminal, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+func (p *Progress) draw() {
+	if p.terminal == nil {
+		return
+	}
+	p.clear()
+	status := []rune(p.status())
+	width := 80
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		width = columns
+	}
+	// a wrapped line could not be cleared with \r
+	if len(status) >= width {
+		status = status[:width-1]
+	}
+	fmt.Fprint(p.terminal, string(status))
+	p.drawn = true
+}
+
+func (p *Progress) logLine() {
+	fmt.Println("PROGRESS:", p.status())
+}
+
+func (p *Progress) status() string {
+	elapsed := max(time.Since(p.start).Seconds(), 0.001)
+	status := fmt.Sprintf("pages %d fetched, %d queued | images %d saved, %d skipped, %d failed | %s, %.1f pages/s, %s/s",
+		p.pagesFetched, p.pagesQueued, p.imagesSaved, p.imagesSkipped, p.imagesFailed,
+		humanSize(p.bytes), float64(p.pagesFetched)/elapsed, humanSize(int64(float64(p.bytes)/elapsed)))
+	if len(p.errorClasses) > 0 {
+		var classes []string
+		for _, class := range sortedByCount(p.errorClasses) {
+			classes = append(classes, fmt.Sprintf("%s %d", class, p.errorClasses[class]))
+		}
+		status += " | errors " + strings.Join(classes, ", ")
+	}
+	if p.throttle != nil {
+		status += " | " + p.throttle.Status()
+	}
+	return status
+}
+
+func (p *Progress) depthStats(depth int) *depthStats {
+	stats := p.depths[depth]
+	if stats == nil {
+		stats = &depthStats{}
+		p.depths[depth] = stats
+	}
+	return stats
+}
+
+func (p *Progress) Queued(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pagesQueued += n
+}
+
+// PageStarted is called for every page about to be fetched.
+func (p *Progress) PageStarted(depth int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.depth = depth
+	if p.pagesQueued > 0 {
+		p.pagesQueued--
+	}
+}
+
+func (p *Progress) PageFetched() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pagesFetched++
+	p.depthStats(p.depth).pages++
+}
+
+// Image counts an image by its outcome. A near-duplicate, found after the
+// crawl, was counted as saved first and is moved to the skipped ones.
+func (p *Progress) Image(entry ManifestEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch entry.Status {
+	case statusSaved:
+		p.imagesSaved++
+		p.bytes += entry.Size
+		p.depthStats(p.depth).images++
+	case statusDuplicate, statusRejected:
+		p.imagesSkipped++
+	case statusNearDuplicate:
+		p.imagesSaved--
+		p.imagesSkipped++
+		if entry.File == "" {
+			p.bytes -= entry.Size
+		}
+	case statusError:
+		p.imagesFailed++
+		p.addError(entry.Reason)
+	}
+}
+
+func (p *Progress) Error(reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addError(reason)
+}
+
+// requestPrefix is the `Get "https://...": ` start of the errors of
+// http.Client, left out to group the causes.
+var requestPrefix = regexp.MustCompile(`^[A-Z]+ "[^"]*": `)
+
+func (p *Progress) addError(reason string) {
+	cause := requestPrefix.ReplaceAllString(reason, "")
+	p.errorClasses[errorClass(cause)]++
+	p.errorCauses[cause]++
+}
+
+func errorClass(cause string) string {
+	cause = strings.ToLower(cause)
+	switch {
+	case strings.HasPrefix(cause, "bad status: 4"):
+		return "http-4xx"
+	case strings.HasPrefix(cause, "bad status: 5"):
+		return "http-5xx"
+	case strings.HasPrefix(cause, "bad status"):
+		return "http"
+	case strings.Contains(cause, "no such host"):
+		return "dns"
+	case strings.Contains(cause, "timeout"), strings.Contains(cause, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(cause, "tls"), strings.Contains(cause, "x509"), strings.Contains(cause, "certificate"):
+		return "tls"
+	case strings.Contains(cause, "connection refused"), strings.Contains(cause, "connection reset"), strings.Contains(cause, "eof"):
+		return "connection"
+	}
+	return "other"
+}
+
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// maxErrorCauses is the number of error causes in the summary.
+const maxErrorCauses = 10
+
+// Summary returns the final statistics of the crawl.
+func (p *Progress) Summary() summaryEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	summary := summaryEvent{
+		DurationMs:    time.Since(p.start).Milliseconds(),
+		PagesFetched:  p.pagesFetched,
+		ImagesSaved:   p.imagesSaved,
+		ImagesSkipped: p.imagesSkipped,
+		ImagesFailed:  p.imagesFailed,
+		Bytes:         p.bytes,
+	}
+	depths := make([]int, 0, len(p.depths))
+	for depth := range p.depths {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+	for _, depth := range depths {
+		summary.Depths = append(summary.Depths, depthSummary{depth, p.depths[depth].pages, p.depths[depth].images})
+	}
+	for i, cause := range sortedByCount(p.errorCauses) {
+		if i == maxErrorCauses {
+			break
+		}
+		summary.Errors = append(summary.Errors, errorSummary{errorClass(cause), cause, p.errorCauses[cause]})
+	}
+	return summary
+}
+
+// PrintSummary prints the final statistics of the crawl.
+func (p *Progress) PrintSummary() {
+	summary := p.Summary()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATISTICS")
+	fmt.Fprintf(w, "  duration\t%s\n", time.Duration(summary.DurationMs)*time.Millisecond)
+	fmt.Fprintf(w, "  pages fetched\t%d\n", summary.PagesFetched)
+	fmt.Fprintf(w, "  images saved\t%d\t%s\n", summary.ImagesSaved, humanSize(summary.Bytes))
+	fmt.Fprintf(w, "  images skipped\t%d\n", summary.ImagesSkipped)
+	fmt.Fprintf(w, "  images failed\t%d\n", summary.ImagesFailed)
+	if p.throttle != nil {
+		fmt.Fprintf(w, "  throttled\t%s\t%s\n", p.throttle.Waited().Round(time.Millisecond), p.throttle.limits())
+	}
+	if len(summary.Depths) > 0 {
+		fmt.Fprintln(w, "  DEPTH\tPAGES\tIMAGES")
+		for _, depth := range summary.Depths {
+			fmt.Fprintf(w, "  %d\t%d\t%d\n", depth.Depth, depth.Pages, depth.Images)
+		}
+	}
+	if len(summary.Errors) > 0 {
+		fmt.Fprintln(w, "  ERRORS\tCLASS\tCAUSE")
+		for _, e := range summary.Errors {
+			fmt.Fprintf(w, "  %d\t%s\t%s\n", e.Count, e.Class, e.Cause)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// UrlRewriter derives the likely original of a resized image URL. rewrite
+// returns false when the URL does not match its pattern.
+type UrlRewriter struct {
+	name    string
+	rewrite func(u *url.URL) (*url.URL, bool)
+}
+
+type originalCandidate struct {
+	url      string
+	rewriter string
+}
+
+// urlRewriters is tried in order, add yours with registerUrlRewriter.
+var urlRewriters = []UrlRewriter{
+	{"wordpress", rewriteWordpress},
+	{"shopify", rewriteShopify},
+	{"cloudinary", rewriteCloudinary},
+	{"imgix", rewriteImgix},
+	{"resize-query", rewriteResizeQuery},
+}
+
+func registerUrlRewriter(name string, rewrite func(u *url.URL) (*url.URL, bool)) {
+	urlRewriters = append(urlRewriters, UrlRewriter{name, rewrite})
+}
+
+// originalCandidates lists the URLs to try before rawURL: all matching
+// rewriters chained first, then each of them alone.
+func originalCandidates(rawURL string) []originalCandidate {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	var single []originalCandidate
+	chained := cloneURL(u)
+	var names []string
+	for _, r := range urlRewriters {
+		if rewritten, ok := r.rewrite(cloneURL(u)); ok {
+			single = append(single, originalCandidate{rewritten.String(), r.name})
+		}
+		if rewritten, ok := r.rewrite(cloneURL(chained)); ok {
+			chained = rewritten
+			names = append(names, r.name)
+		}
+	}
+
+	var candidates []originalCandidate
+	if len(names) > 1 {
+		candidates = append(candidates, originalCandidate{chained.String(), strings.Join(names, "+")})
+	}
+	candidates = append(candidates, single...)
+
+	seen := map[string]bool{rawURL: true}
+	unique := candidates[:0]
+	for _, c := range candidates {
+		if !seen[c.url] {
+			seen[c.url] = true
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+func cloneURL(u *url.URL) *url.URL {
+	clone := *u
+	return &clone
+}
+
+var wordpressSize = regexp.MustCompile(`-(\d+x\d+|scaled|e\d{10,})(\.[A-Za-z0-9]+)$`)
+
+// photo-300x200.jpg, photo-scaled.jpg -> photo.jpg
+func rewriteWordpress(u *url.URL) (*url.URL, bool) {
+	if !wordpressSize.MatchString(u.Path) {
+		return nil, false
+	}
+	u.Path = wordpressSize.ReplaceAllString(u.Path, "$2")
+	u.RawPath = ""
+	return u, true
+}
+
+var shopifySize = regexp.MustCompile(`_(\d*x\d*|pico|icon|thumb|small|compact|medium|large|grande|master)(_crop_[a-z]+)?(@\dx)?(\.[A-Za-z0-9]+)$`)
+
+// photo_300x200.jpg, photo_grande.jpg, photo_300x@2x.jpg -> photo.jpg
+func rewriteShopify(u *url.URL) (*url.URL, bool) {
+	if !strings.Contains(u.Host, "shopify") && !strings.Contains(u.Path, "/cdn/shop/") {
+		return nil, false
+	}
+	changed := false
+	if shopifySize.MatchString(u.Path) {
+		u.Path = shopifySize.ReplaceAllString(u.Path, "$4")
+		u.RawPath = ""
+		changed = true
+	}
+	if removeQueryParams(u, "width", "height", "crop") {
+		changed = true
+	}
+	return u, changed
+}
+
+var cloudinaryTransformation = regexp.MustCompile(`^[a-z]{1,3}_[^/]*$`)
+
+// /image/upload/c_scale,w_300/v123/photo.jpg -> /image/upload/v123/photo.jpg
+func rewriteCloudinary(u *url.URL) (*url.URL, bool) {
+	if !strings.Contains(u.Host, "cloudinary") {
+		return nil, false
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if segment != "upload" && segment != "fetch" {
+			continue
+		}
+		end := i + 1
+		for end < len(segments)-1 && isCloudinaryTransformation(segments[end]) {
+			end++
+		}
+		if end == i+1 {
+			return nil, false
+		}
+		u.Path = strings.Join(append(segments[:i+1], segments[end:]...), "/")
+		u.RawPath = ""
+		return u, true
+	}
+	return nil, false
+}
+
+func isCloudinaryTransformation(segment string) bool {
+	for part := range strings.SplitSeq(segment, ",") {
+		if !cloudinaryTransformation.MatchString(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// imgix renders every variant from query parameters: without them it serves
+// the source image.
+func rewriteImgix(u *url.URL) (*url.URL, bool) {
+	if !strings.HasSuffix(u.Hostname(), ".imgix.net") || u.RawQuery == "" {
+		return nil, false
+	}
+	u.RawQuery = ""
+	return u, true
+}
+
+// ?w=300&h=200, ?resize=300,200 (Jetpack, Next.js, most image proxies)
+func rewriteResizeQuery(u *url.URL) (*url.URL, bool) {
+	if !removeQueryParams(u, "w", "h", "width", "height", "resize", "fit", "crop", "size", "quality", "q", "dpr") {
+		return nil, false
+	}
+	return u, true
+}
+
+func removeQueryParams(u *url.URL, keys ...string) bool {
+	query := u.Query()
+	removed := false
+	for _, key := range keys {
+		if query.Has(key) {
+			query.Del(key)
+			removed = true
+		}
+	}
+	if removed {
+		u.RawQuery = query.Encode()
+	}
+	return removed
+}
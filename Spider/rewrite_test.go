@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestUrlRewriters(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite func(u *url.URL) (*url.URL, bool)
+		url     string
+		want    string // "" when the rewriter does not match
+	}{
+		{"wordpress size", rewriteWordpress, "https://blog.test/wp-content/uploads/photo-300x200.jpg", "https://blog.test/wp-content/uploads/photo.jpg"},
+		{"wordpress scaled", rewriteWordpress, "https://blog.test/uploads/photo-scaled.jpeg", "https://blog.test/uploads/photo.jpeg"},
+		{"wordpress edited", rewriteWordpress, "https://blog.test/uploads/photo-e1612345678.png", "https://blog.test/uploads/photo.png"},
+		{"wordpress query kept", rewriteWordpress, "https://blog.test/photo-1024x768.jpg?ver=2", "https://blog.test/photo.jpg?ver=2"},
+		{"wordpress no size", rewriteWordpress, "https://blog.test/photo-large.jpg", ""},
+		{"wordpress size in a directory", rewriteWordpress, "https://blog.test/300x200/photo.jpg", ""},
+
+		{"shopify size", rewriteShopify, "https://cdn.shopify.com/s/files/1/products/shirt_300x200.jpg", "https://cdn.shopify.com/s/files/1/products/shirt.jpg"},
+		{"shopify named size", rewriteShopify, "https://cdn.shopify.com/products/shirt_grande.png", "https://cdn.shopify.com/products/shirt.png"},
+		{"shopify crop and retina", rewriteShopify, "https://cdn.shopify.com/products/shirt_300x_crop_center@2x.jpg", "https://cdn.shopify.com/products/shirt.jpg"},
+		{"shopify query", rewriteShopify, "https://shop.test/cdn/shop/products/shirt.jpg?v=1&width=400", "https://shop.test/cdn/shop/products/shirt.jpg?v=1"},
+		{"shopify other host", rewriteShopify, "https://shop.test/images/shirt_300x200.jpg", ""},
+		{"shopify original", rewriteShopify, "https://cdn.shopify.com/products/shirt.jpg", ""},
+
+		{"cloudinary", rewriteCloudinary, "https://res.cloudinary.com/demo/image/upload/c_scale,w_300/v123/photo.jpg", "https://res.cloudinary.com/demo/image/upload/v123/photo.jpg"},
+		{"cloudinary chained", rewriteCloudinary, "https://res.cloudinary.com/demo/image/upload/c_fill,h_200/q_auto,f_auto/photo.jpg", "https://res.cloudinary.com/demo/image/upload/photo.jpg"},
+		{"cloudinary fetch", rewriteCloudinary, "https://res.cloudinary.com/demo/image/fetch/w_300/https://site.test/a.jpg", "https://res.cloudinary.com/demo/image/fetch/https://site.test/a.jpg"},
+		{"cloudinary original", rewriteCloudinary, "https://res.cloudinary.com/demo/image/upload/v123/photo.jpg", ""},
+		// a file name looking like a transformation is kept
+		{"cloudinary file name", rewriteCloudinary, "https://res.cloudinary.com/demo/image/upload/w_300", ""},
+		{"cloudinary other host", rewriteCloudinary, "https://site.test/image/upload/w_300/photo.jpg", ""},
+
+		{"imgix", rewriteImgix, "https://assets.imgix.net/photo.jpg?w=300&fit=crop", "https://assets.imgix.net/photo.jpg"},
+		{"imgix original", rewriteImgix, "https://assets.imgix.net/photo.jpg", ""},
+		{"imgix other host", rewriteImgix, "https://imgix.net.test/photo.jpg?w=300", ""},
+
+		{"resize query", rewriteResizeQuery, "https://site.test/photo.jpg?w=300&h=200&id=7", "https://site.test/photo.jpg?id=7"},
+		{"resize jetpack", rewriteResizeQuery, "https://i0.wp.com/site.test/photo.jpg?resize=300%2C200&ssl=1", "https://i0.wp.com/site.test/photo.jpg?ssl=1"},
+		{"resize none", rewriteResizeQuery, "https://site.test/photo.jpg?id=7", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if rewritten, ok := test.rewrite(u); ok {
+				got = rewritten.String()
+			}
+			if got != test.want {
+				t.Errorf("rewrite(%s) = %q, want %q", test.url, got, test.want)
+			}
+		})
+	}
+}
+
+func TestOriginalCandidates(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want []originalCandidate
+	}{
+		{
+			name: "chained first",
+			url:  "https://blog.test/uploads/photo-300x200.jpg?w=300",
+			want: []originalCandidate{
+				{"https://blog.test/uploads/photo.jpg", "wordpress+resize-query"},
+				{"https://blog.test/uploads/photo.jpg?w=300", "wordpress"},
+				{"https://blog.test/uploads/photo-300x200.jpg", "resize-query"},
+			},
+		},
+		{
+			name: "single",
+			url:  "https://assets.imgix.net/photo.jpg?w=300",
+			want: []originalCandidate{
+				{"https://assets.imgix.net/photo.jpg", "imgix"},
+			},
+		},
+		{
+			// imgix and resize-query give the same URL, tried once
+			name: "duplicates removed",
+			url:  "https://assets.imgix.net/photo-300x200.jpg?w=300",
+			want: []originalCandidate{
+				{"https://assets.imgix.net/photo.jpg", "wordpress+imgix"},
+				{"https://assets.imgix.net/photo.jpg?w=300", "wordpress"},
+				{"https://assets.imgix.net/photo-300x200.jpg", "imgix"},
+			},
+		},
+		{
+			name: "original",
+			url:  "https://site.test/photo.jpg",
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := originalCandidates(test.url); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("originalCandidates() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// sizedPNG is a PNG of the given dimensions, noisy enough to grow with them.
+func sizedPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7919 % 251)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRejectedOriginalFallsBack(t *testing.T) {
+	original, variant := sizedPNG(t, 640, 480), sizedPNG(t, 32, 24)
+	server := testSite(t, map[string][]byte{
+		"/":                []byte(`<html><body><img src="/photo-32x24.png"></body></html>`),
+		"/photo.png":       original,
+		"/photo-32x24.png": variant,
+	})
+
+	tests := []struct {
+		name   string
+		filter ImageFilter
+	}{
+		{"rejected by its header", ImageFilter{maxWidth: 100}},
+		{"rejected by its Content-Length", ImageFilter{maxSize: int64(len(variant)) + 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := testCrawl(t, server.URL+"/", t.TempDir(), func(spider *Spider) {
+				spider.originals = true
+				spider.filter = test.filter
+			})
+			if len(entries) != 1 {
+				t.Fatalf("manifest %+v, want only the image of the page", entries)
+			}
+			if entry := entries[0]; entry.Status != statusSaved || entry.URL != server.URL+"/photo-32x24.png" || entry.VariantOf != "" {
+				t.Errorf("manifest entry %+v, want the image of the page saved", entry)
+			}
+		})
+	}
+}
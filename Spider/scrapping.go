@@ -1,18 +1,22 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 	"io"
+	"io/fs"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
-	"slices"
 	"strings"
 )
 
@@ -21,26 +25,24 @@ func isValidURL(rawURL string) bool {
 	if err != nil {
 		return false
 	}
-	return u.Scheme == "http" || u.Scheme == "https"
+	return u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "file"
 }
 
 func explore_body(spider *Spider, currentUrl string, idx int) {
-	body_html, err := fetch_and_extract_body(currentUrl)
-	if err != nil {
+	spider.graph.PageVisited(currentUrl, idx)
+	spider.progress.PageStarted(idx)
+	body_html, err := fetch_and_extract_body(spider, currentUrl, idx)
+	if err != nil || body_html == nil {
 		return
 	}
+	spider.progress.PageFetched()
 
 	fmt.Println("LINK:", currentUrl, "| DEPTH:", idx, strings.Repeat(`▄▖`, idx))
+	spider.stats.pages++
 
-	var links []string
+	var links []Candidate
 	for n := range body_html.Descendants() {
-		download_images(n, spider.baseUrl, spider.pFlag, spider.valid_ext)
-		if mustLaunchRecursion(spider, idx) {
-			if link := extract_url(n, spider); len(link) > 0 {
-				links = append(links, link)
-				continue
-			}
-		}
+		links = append(links, extract_candidates(n, spider, currentUrl, mustLaunchRecursion(spider, idx))...)
 	}
 
 	if mustLaunchRecursion(spider, idx) {
@@ -53,114 +55,331 @@ func mustLaunchRecursion(spider *Spider, idx int) bool {
 	return spider.rFlag && idx < spider.lFlag
 }
 
-func launch_recursion(links []string, spider *Spider, idx int) {
+func launch_recursion(links []Candidate, spider *Spider, idx int) {
 
+	spider.progress.Queued(len(links))
 	for _, n := range links {
-		explore_body(spider, n, idx)
-	}
-}
-
-func extract_url(currentNode *html.Node, spider *Spider) string {
-	if currentNode.Type == html.ElementNode && currentNode.DataAtom == atom.A {
-		for _, a := range currentNode.Attr {
-			if a.Key == "href" {
-				// fmt.Println("----------------------One URL----------------------")
-				// fmt.Println("Before compose absolute path:")
-				absolutePath, err := createAbsolutePathIfIsNot(spider.baseUrl, a.Val)
-				if err != nil || !isValidURL(absolutePath) {
-					continue
-				}
-				// fmt.Println("After compose absoulute path:")
-				// fmt.Println(absolutePath)
-				// fmt.Println("---------------------------------------------------")
-				// fmt.Println(currentUrl)
-				// if spider.visited_url[absolutePath] {
-				// 	break
-				// }
-				// body_html, err := fetch_and_extract_body(absolutePath)
-				// if err != nil {
-				// 	continue
-				// }
-				// fmt.Println(a.Val)
-
-				if !spider.visited_url[absolutePath] {
-					// fmt.Println(a.Val)
-					spider.visited_url[absolutePath] = true
-					return absolutePath
-				}
-				return ""
-			}
+		if n.Kind == candidateEndpoint {
+			explore_endpoint(spider, n.URL, idx)
+			continue
 		}
+		explore_body(spider, n.URL, idx)
+	}
+}
+
+// imageRef is an image found while crawling and where it was found.
+type imageRef struct {
+	url       string
+	page      string
+	source    string
+	thumbnail string
+	variant   string // set on the guessed originals of -originals
+	rewriter  string
+}
+
+// extract_img_src yields the src of <img> elements.
+func extract_img_src(currentNode *html.Node, spider *Spider, page string) []Candidate {
+	if currentNode.Type != html.ElementNode || currentNode.DataAtom != atom.Img {
+		return nil
 	}
-	return ""
-}
-
-func download_images(currentNode *html.Node, baseUrl *url.URL, downloadDirectory string, validExt []string) {
-
-	if currentNode.Type == html.ElementNode && currentNode.DataAtom == atom.Img {
-		for _, a := range currentNode.Attr {
-			if a.Key == "src" {
-				// fmt.Println("Extracting image:")
-				// fmt.Println("Before compose absolute path:", a.Val)
-				absolutePath, err := createAbsolutePathIfIsNot(baseUrl, a.Val)
-				if err != nil {
-					continue
-					// log.Fatal(err)
-				}
-				// fmt.Println("After compose absolute path:", absolutePath)
-				// fmt.Println("Extension", filepath.Ext(absolutePath))
-				if slices.Contains(validExt, filepath.Ext(absolutePath)) {
-					// fmt.Println("Record image:", absolutePath)
-					writeImgFile(absolutePath, downloadDirectory)
-				}
+	var candidates []Candidate
+	for _, a := range currentNode.Attr {
+		if a.Key != "src" {
+			continue
+		}
+		if isDataURI(a.Val) {
+			candidates = append(candidates, Candidate{Kind: candidateImage, URL: a.Val, Source: "img"})
+			continue
+		}
+		absolutePath, err := createAbsolutePathIfIsNot(spider.baseUrl, a.Val)
+		if err != nil {
+			continue
+		}
+		candidates = append(candidates, Candidate{Kind: candidateImage, URL: absolutePath, Source: "img"})
+	}
+	return candidates
+}
+
+func writeImgFile(spider *Spider, ref imageRef) {
+	if spider.originals {
+		for _, candidate := range originalCandidates(ref.url) {
+			original := ref
+			original.url = candidate.url
+			original.variant = ref.url
+			original.rewriter = candidate.rewriter
+			if fetchImage(spider, original, true) {
+				return
 			}
+		}
+	}
+	fetchImage(spider, ref, false)
+}
+
+// fetchImage downloads and stores one image. Guessed URLs are quiet: their
+// failures are expected and neither logged nor recorded.
+func fetchImage(spider *Spider, ref imageRef, guessed bool) bool {
+	resp, err := spider.client.Get(ref.url)
+	if err != nil {
+		if !guessed {
+			log.Printf("Error downloading %s: %v\n", ref.url, err)
+			recordImageError(spider, ref, err.Error())
+		}
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if !guessed {
+			spider.graph.Image(ref.page, ref.url, resp.StatusCode, resp.Header.Get("Content-Type"))
+			log.Printf("Bad status for %s: %s\n", ref.url, resp.Status)
+			recordImageError(spider, ref, "bad status: "+resp.Status)
+		}
+		return false
+	}
 
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if guessed && !strings.HasPrefix(mediaType, "image/") {
+		return false
+	}
+	spider.graph.Image(ref.page, ref.url, resp.StatusCode, mediaType)
+	if spider.filter.maxSize > 0 && resp.ContentLength > spider.filter.maxSize {
+		if !guessed {
+			rejectImage(spider, ref.manifestEntry(), spider.filter.checkSize(resp.ContentLength))
 		}
+		return false
+	}
 
+	fileName := path.Base(ref.url)
+	if u, err := url.Parse(ref.url); err == nil {
+		fileName = path.Base(u.Path)
+	}
+	if path.Ext(fileName) == "" {
+		fileName += mediaTypeExtension(mediaType)
 	}
+	return storeImage(spider, ref, fileName, resp.Body)
 }
 
-func writeImgFile(absolutePath string, downloadDirectory string) {
-	fileName := path.Base(absolutePath)
-	filePath := filepath.Join(downloadDirectory, fileName)
+// storeImage writes an image under downloadDirectory unless it is rejected
+// by the filters or the same content was already stored during the crawl.
+// Every outcome goes to the manifest but the rejections of guessed
+// originals, after which the image of the page is tried. It tells if the
+// image was stored or found to be a duplicate.
+func storeImage(spider *Spider, ref imageRef, fileName string, content io.Reader) bool {
+	spider.graph.Image(ref.page, ref.url, 0, "")
+	entry := ref.manifestEntry()
+	reject := func(reason string) bool {
+		if ref.variant == "" {
+			rejectImage(spider, entry, reason)
+		}
+		return false
+	}
+
+	reader := bufio.NewReaderSize(content, sniffSize)
+	head, _ := reader.Peek(sniffSize)
+	header := sniffImage(head)
+	entry.Format = header.format
+	entry.Width, entry.Height = header.width, header.height
+	if reason := spider.filter.checkHeader(header); reason != "" {
+		return reject(reason)
+	}
+	content = reader
+	if spider.filter.maxSize > 0 {
+		content = io.LimitReader(reader, spider.filter.maxSize+1)
+	}
 
-	f, err := os.Create(filePath)
+	pattern := ".spider-*"
+	if spider.stripMeta {
+		ext := cleanableExtension(header.format)
+		if ext == "" {
+			return reject(fmt.Sprintf("metadata of format %s can't be stripped", normalizeFormat(header.format)))
+		}
+		pattern += ext
+	}
+	tmp, err := os.CreateTemp(spider.pFlag, pattern)
 	if err != nil {
-		log.Printf("Error creating file %s: %v\n", filePath, err)
-		return
+		log.Printf("Error creating file in %s: %v\n", spider.pFlag, err)
+		recordImageError(spider, ref, err.Error())
+		return false
 	}
-	defer f.Close()
+	defer os.Remove(tmp.Name())
 
-	resp, err := http.Get(absolutePath)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), content)
+	tmp.Close()
 	if err != nil {
-		log.Printf("Error downloading %s: %v\n", absolutePath, err)
-		return
+		log.Printf("Error writing file %s: %v\n", fileName, err)
+		recordImageError(spider, ref, err.Error())
+		return false
 	}
-	defer resp.Body.Close()
+	if reason := spider.filter.checkSize(size); reason != "" {
+		return reject(reason)
+	}
+	stored := tmp.Name()
+	var original *scorpionResult
+	if spider.stripMeta {
+		cleaned, before, err := stripMetadata(spider, stored)
+		if err != nil {
+			log.Printf("Error stripping the metadata of %s: %v\n", ref.url, err)
+			recordImageError(spider, ref, err.Error())
+			return false
+		}
+		defer os.Remove(cleaned)
+		stored, original = cleaned, before
+		entry.MetadataRemoved = leakCategoryNames(classifyLeaks(before.Tags))
+		if size, err = hashFile(stored, hash); err != nil {
+			recordImageError(spider, ref, err.Error())
+			return false
+		}
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	entry.SHA256 = sum
+	entry.Size = size
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Bad status for %s: %s\n", absolutePath, resp.Status)
-		return
+	if first, ok := spider.seen_hash[sum]; ok {
+		entry.Status = statusDuplicate
+		entry.DuplicateOf = first
+		addEntry(spider, entry)
+		return true
 	}
 
-	_, err = io.Copy(f, resp.Body)
-	if err != nil {
+	filePath := uniqueFilePath(spider.pFlag, fileName, sum)
+	// CreateTemp makes the file private, stored images are readable as
+	// when created in place
+	if err := os.Chmod(stored, 0644); err != nil {
 		log.Printf("Error writing file %s: %v\n", filePath, err)
-		return
+		recordImageError(spider, ref, err.Error())
+		return false
+	}
+	if err := os.Rename(stored, filePath); err != nil {
+		log.Printf("Error writing file %s: %v\n", filePath, err)
+		recordImageError(spider, ref, err.Error())
+		return false
+	}
+	spider.seen_hash[sum] = filePath
+
+	entry.Status = statusSaved
+	entry.File = filePath
+	addEntry(spider, entry)
+	fmt.Println("IMAGE:", ref.url, "| SOURCE:", ref.source)
+	if len(entry.MetadataRemoved) > 0 {
+		fmt.Println("STRIPPED:", ref.url, "|", strings.Join(entry.MetadataRemoved, ", "))
+	}
+	if spider.nearDup {
+		addPerceptualHash(spider, entry)
+	}
+	if spider.leakReport != "" {
+		scanImageLeaks(spider, entry, original)
+	}
+	return true
+}
+
+func (ref imageRef) manifestEntry() ManifestEntry {
+	return ManifestEntry{
+		URL:       ref.url,
+		Page:      ref.page,
+		Source:    ref.source,
+		Thumbnail: ref.thumbnail,
+		VariantOf: ref.variant,
+		Rewriter:  ref.rewriter,
+	}
+}
+
+func rejectImage(spider *Spider, entry ManifestEntry, reason string) {
+	entry.Status = statusRejected
+	entry.Reason = reason
+	addEntry(spider, entry)
+}
+
+// uniqueFilePath keeps fileName unless another image already uses it, in
+// which case the start of the content hash is appended to the name, longer
+// then numbered until the name is free or holds the same image.
+func uniqueFilePath(downloadDirectory string, fileName string, sum string) string {
+	if fileName == "" || fileName == "/" || fileName == "." {
+		fileName = sum[:16]
+	}
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+	for _, name := range []string{fileName, base + "-" + sum[:8] + ext, base + "-" + sum[:16] + ext} {
+		filePath := filepath.Join(downloadDirectory, name)
+		if free, same := fileHolds(filePath, sum); free || same {
+			return filePath
+		}
+	}
+	for i := 1; ; i++ {
+		filePath := filepath.Join(downloadDirectory, fmt.Sprintf("%s-%s-%d%s", base, sum[:16], i, ext))
+		if free, same := fileHolds(filePath, sum); free || same {
+			return filePath
+		}
 	}
 }
 
-func fetch_and_extract_body(url string) (*html.Node, error) {
+// fileHolds tells whether filePath is free, or holds the content of hash sum,
+// like the same image left by a previous crawl.
+func fileHolds(filePath string, sum string) (free bool, same bool) {
+	existing, err := os.Open(filePath)
+	if err != nil {
+		return errors.Is(err, fs.ErrNotExist), false
+	}
+	defer existing.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, existing); err != nil {
+		return false, false
+	}
+	return false, hex.EncodeToString(hash.Sum(nil)) == sum
+}
+
+func recordImageError(spider *Spider, ref imageRef, reason string) {
+	spider.graph.Image(ref.page, ref.url, 0, "")
+	entry := ref.manifestEntry()
+	entry.Status = statusError
+	entry.Reason = reason
+	addEntry(spider, entry)
+}
 
-	resp, err := http.Get(url)
+// fetchPage gets a page of the crawl, or a JSON endpoint, and records it in
+// the graph, the watch index, the progress and the events.
+func fetchPage(spider *Spider, url string, idx int) (*http.Response, error) {
+	resp, err := spider.client.Get(url)
+	if err != nil {
+		spider.graph.PageFetched(url, 0, "")
+		spider.index.Page(url, 0, err.Error())
+		spider.progress.Error(err.Error())
+		spider.events.PageError(url, err.Error())
+		log.Println(err)
+		return nil, err
+	}
+	spider.graph.PageFetched(url, resp.StatusCode, resp.Header.Get("Content-Type"))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		// the images of the page are not reported removed by watch
+		spider.index.Page(url, resp.StatusCode, "bad status: "+resp.Status)
+	} else {
+		spider.index.Page(url, resp.StatusCode, "")
+	}
+	spider.events.PageFetched(url, idx, resp.StatusCode, resp.Header.Get("Content-Type"))
+	if resp.StatusCode >= http.StatusBadRequest {
+		spider.progress.Error("bad status: " + resp.Status)
+		spider.events.PageError(url, "bad status: "+resp.Status)
+	}
+	return resp, nil
+}
+
+func fetch_and_extract_body(spider *Spider, url string, idx int) (*html.Node, error) {
+
+	resp, err := fetchPage(spider, url, idx)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 	defer resp.Body.Close()
-	body_html, err := html.Parse(resp.Body)
+	body, mediaType, ok := htmlBody(resp)
+	if !ok {
+		fmt.Println("SKIP:", url, "| not HTML:", mediaType)
+		return nil, nil
+	}
+	body_html, err := html.Parse(body)
 	if err != nil {
-		log.Fatal(err)
+		spider.progress.Error(err.Error())
+		spider.events.PageError(url, err.Error())
+		log.Println(err)
 		return nil, err
 	}
 	return body_html, nil
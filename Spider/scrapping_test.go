@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUniqueFilePath(t *testing.T) {
+	content := []byte("image")
+	hash := sha256.Sum256(content)
+	sum := hex.EncodeToString(hash[:])
+
+	tests := []struct {
+		name     string
+		existing map[string]string
+		fileName string
+		want     string
+	}{
+		{"free", nil, "a.png", "a.png"},
+		{"no name", nil, "/", sum[:16]},
+		{"same image", map[string]string{"a.png": "image"}, "a.png", "a.png"},
+		{"taken", map[string]string{"a.png": "other"}, "a.png", "a-" + sum[:8] + ".png"},
+		{"fallback holds the image", map[string]string{"a.png": "other", "a-" + sum[:8] + ".png": "image"}, "a.png", "a-" + sum[:8] + ".png"},
+		{"fallback taken", map[string]string{"a.png": "other", "a-" + sum[:8] + ".png": "other"}, "a.png", "a-" + sum[:16] + ".png"},
+		{"all taken", map[string]string{
+			"a.png":                    "other",
+			"a-" + sum[:8] + ".png":    "other",
+			"a-" + sum[:16] + ".png":   "other",
+			"a-" + sum[:16] + "-1.png": "other",
+		}, "a.png", "a-" + sum[:16] + "-2.png"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := uniqueFilePath(dir, test.fileName, sum); got != filepath.Join(dir, test.want) {
+				t.Errorf("uniqueFilePath() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStoredImageMode(t *testing.T) {
+	server := testSite(t, map[string][]byte{
+		"/":      []byte(`<html><body><img src="/a.png"></body></html>`),
+		"/a.png": testPNG(t, 0),
+	})
+	dir := t.TempDir()
+	entries := testCrawl(t, server.URL+"/", dir, nil)
+	if len(entries) != 1 || entries[0].Status != statusSaved {
+		t.Fatalf("manifest %+v, want one saved image", entries)
+	}
+	info, err := os.Stat(filepath.Join(dir, entries[0].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0644 {
+		t.Errorf("stored image mode %v, want -rw-r--r--", mode)
+	}
+}
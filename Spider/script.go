@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// The images found by guessing in scripts and JSON are marked with these
+// sources, in the output and the manifest.
+const (
+	sourceScriptJSON   = "heuristic:script-json"
+	sourceScript       = "heuristic:script"
+	sourceJSONEndpoint = "heuristic:json-endpoint"
+)
+
+// maxJSONEndpointSize is the most read of a JSON endpoint.
+const maxJSONEndpointSize = 10 << 20
+
+// jsStringLiteral matches the "double", 'single' and `template` string
+// literals of a script.
+var jsStringLiteral = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|` + "`(?:[^`\\\\]|\\\\.)*`")
+
+// embeddedURL matches the absolute URLs inside a longer string, like the
+// <img src> of some HTML kept in JSON.
+var embeddedURL = regexp.MustCompile(`(?i)(?:https?:)?//[^\s"'<>()\\,]+`)
+
+// extract_script_images guesses the images of single-page apps, which ship
+// their data in scripts: JSON blocks (__NEXT_DATA__), string literals of
+// inline JS (window.__INITIAL_STATE__ = ...) and the JSON endpoints they
+// name, crawled as links. Every string looking like an image URL is resolved
+// against the page.
+func extract_script_images(currentNode *html.Node, spider *Spider, page string) []Candidate {
+	if currentNode.Type != html.ElementNode {
+		return nil
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+
+	switch currentNode.DataAtom {
+	case atom.Script:
+		if getAttr(currentNode, "src") != "" || currentNode.FirstChild == nil {
+			return nil
+		}
+		text := currentNode.FirstChild.Data
+		scriptType := strings.ToLower(strings.TrimSpace(getAttr(currentNode, "type")))
+		switch {
+		// JSON-LD is read by the metadata extractor
+		case scriptType == "application/ld+json":
+			return nil
+		case strings.HasSuffix(scriptType, "json"):
+			var data any
+			if json.Unmarshal([]byte(text), &data) == nil {
+				return scriptCandidates(spider, base, jsonStrings(data, nil), sourceScriptJSON)
+			}
+			return scriptCandidates(spider, base, jsStrings(text), sourceScript)
+		case slices.Contains([]string{"", "text/javascript", "application/javascript", "module"}, scriptType):
+			return scriptCandidates(spider, base, jsStrings(text), sourceScript)
+		}
+
+	case atom.Link:
+		// <link rel="alternate" type="application/json"> of WordPress and
+		// <link rel="preload" as="fetch"> of the apps
+		if strings.HasSuffix(strings.ToLower(getAttr(currentNode, "type")), "json") ||
+			strings.ToLower(getAttr(currentNode, "as")) == "fetch" {
+			if endpoint, err := createAbsolutePathIfIsNot(base, getAttr(currentNode, "href")); err == nil {
+				return []Candidate{{Kind: candidateEndpoint, URL: endpoint, Source: sourceJSONEndpoint}}
+			}
+		}
+	}
+	return nil
+}
+
+// jsStrings returns the string literals of a script, unescaped. A literal
+// holding JSON, like the argument of JSON.parse, gives its strings instead.
+func jsStrings(script string) []string {
+	var values []string
+	for _, literal := range jsStringLiteral.FindAllString(script, -1) {
+		value := unescapeJSLiteral(literal)
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			var data any
+			if json.Unmarshal([]byte(trimmed), &data) == nil {
+				values = jsonStrings(data, values)
+				continue
+			}
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// unescapeJSLiteral returns the value of a string literal, quotes removed.
+func unescapeJSLiteral(literal string) string {
+	if literal[0] == '"' {
+		var value string
+		if json.Unmarshal([]byte(literal), &value) == nil {
+			return value
+		}
+	}
+	return unescapeJS(literal[1 : len(literal)-1])
+}
+
+// unescapeJS decodes the escape sequences of a JS string: \n, \xHH, \uHHHH,
+// \u{H...} and the escaped characters standing for themselves, like \/.
+func unescapeJS(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch c := value[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case '0':
+			b.WriteByte(0)
+		case '\n':
+			// line continuation
+		case 'x', 'u':
+			hex, size := jsEscapeDigits(value[i+1:], c)
+			code, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil {
+				b.WriteByte(c)
+				continue
+			}
+			b.WriteRune(rune(code))
+			i += size
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// jsEscapeDigits returns the hex digits of a \xHH, \uHHHH or \u{H...} escape
+// and how many bytes they take after the x or u.
+func jsEscapeDigits(rest string, escape byte) (string, int) {
+	if escape == 'u' && strings.HasPrefix(rest, "{") {
+		if end := strings.IndexByte(rest, '}'); end > 0 {
+			return rest[1:end], end + 1
+		}
+	}
+	size := 2
+	if escape == 'u' {
+		size = 4
+	}
+	size = min(size, len(rest))
+	return rest[:size], size
+}
+
+// jsonStrings appends all the strings of a JSON document to values.
+func jsonStrings(data any, values []string) []string {
+	switch v := data.(type) {
+	case string:
+		values = append(values, v)
+	case []any:
+		for _, item := range v {
+			values = jsonStrings(item, values)
+		}
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			values = jsonStrings(v[key], values)
+		}
+	}
+	return values
+}
+
+// scriptCandidates keeps the strings that look like image URLs, and the JSON
+// endpoints named.
+func scriptCandidates(spider *Spider, base *url.URL, values []string, source string) []Candidate {
+	var candidates []Candidate
+	seen := make(map[string]bool)
+	add := func(value string) {
+		absolutePath, err := createAbsolutePathIfIsNot(base, value)
+		if err != nil || seen[absolutePath] {
+			return
+		}
+		seen[absolutePath] = true
+		switch ext := imageExt(absolutePath); {
+		case slices.Contains(spider.valid_ext, ext):
+			candidates = append(candidates, Candidate{Kind: candidateImage, URL: absolutePath, Source: source})
+		case ext == ".json":
+			candidates = append(candidates, Candidate{Kind: candidateEndpoint, URL: absolutePath, Source: sourceJSONEndpoint})
+		}
+	}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if looksLikeURL(value) {
+			add(value)
+			continue
+		}
+		for _, embedded := range embeddedURL.FindAllString(value, -1) {
+			add(embedded)
+		}
+	}
+	return candidates
+}
+
+// looksLikeURL tells the strings that could be a URL or a path from the
+// text, names and numbers of the data.
+func looksLikeURL(value string) bool {
+	return value != "" && len(value) < 2048 && strings.Contains(value, "/") &&
+		!strings.ContainsAny(value, " \t\n<>{}") && !isDataURI(value)
+}
+
+// explore_endpoint fetches a JSON endpoint as a page of the crawl and
+// downloads the images it names, resolved against the endpoint URL. The
+// endpoints it names in turn are not fetched.
+func explore_endpoint(spider *Spider, endpoint string, idx int) {
+	spider.graph.PageVisited(endpoint, idx)
+	spider.progress.PageStarted(idx)
+	resp, err := fetchPage(spider, endpoint, idx)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	var data any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJSONEndpointSize)).Decode(&data); err != nil {
+		fmt.Println("SKIP:", endpoint, "| not JSON:", err)
+		return
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return
+	}
+	spider.progress.PageFetched()
+
+	fmt.Println("ENDPOINT:", endpoint, "| DEPTH:", idx, strings.Repeat(`▄▖`, idx))
+	spider.stats.pages++
+
+	for _, candidate := range scriptCandidates(spider, base, jsonStrings(data, nil), sourceJSONEndpoint) {
+		candidate.Page = endpoint
+		handle_candidate(spider, candidate, false)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnescapeJSLiteral(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    string
+	}{
+		{`"plain"`, "plain"},
+		{`"\/img\/a.png"`, "/img/a.png"},
+		{`"https://cdn.test/a.png"`, "https://cdn.test/a.png"},
+		{`'https://cdn.test/a.png'`, "https://cdn.test/a.png"},
+		{"`https:\\u002F\\u002Fcdn.test\\u002Fa.png`", "https://cdn.test/a.png"},
+		{`'\x2Fa.png'`, "/a.png"},
+		{`'\u{1F600}'`, "\U0001F600"},
+		{`'it\'s'`, "it's"},
+		{`'a\nb'`, "a\nb"},
+		// not valid JSON, decoded as JS
+		{`"\x2Fa.png"`, "/a.png"},
+		{`'\u00zz'`, "u00zz"},
+		{`''`, ""},
+	}
+	for _, test := range tests {
+		if got := unescapeJSLiteral(test.literal); got != test.want {
+			t.Errorf("unescapeJSLiteral(%s) = %q, want %q", test.literal, got, test.want)
+		}
+	}
+}
+
+func TestJsStrings(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "literals",
+			script: `var a = "one"; let b = 'two'; const c = ` + "`three`",
+			want:   []string{"one", "two", "three"},
+		},
+		{
+			name:   "escaped initial state",
+			script: `window.__INITIAL_STATE__ = {hero: 'https://cdn.test/hero.jpg'}`,
+			want:   []string{"https://cdn.test/hero.jpg"},
+		},
+		{
+			name:   "JSON.parse",
+			script: `window.data = JSON.parse('{"images":["/a.png","/b.png"],"title":"t"}')`,
+			want:   []string{"/a.png", "/b.png", "t"},
+		},
+		{
+			name:   "quotes inside literals",
+			script: `x("it's", 'say "hi"')`,
+			want:   []string{"it's", `say "hi"`},
+		},
+		{
+			name:   "no literal",
+			script: `var n = 1 + 2;`,
+			want:   nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := jsStrings(test.script); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("jsStrings() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONEndpoints(t *testing.T) {
+	files := map[string][]byte{
+		"/": []byte(`<html><head><link rel="alternate" type="application/json" href="/api/page.json"></head>
+<body><script>window.feed = '/api/feed.json';</script></body></html>`),
+		"/api/page.json":    []byte(`{"cover": "/cover.png"}`),
+		"/api/feed.json":    []byte(`{"items": [{"image": "img/item.png"}, {"more": "/api/more.json"}]}`),
+		"/api/more.json":    []byte(`{"image": "/more.png"}`),
+		"/cover.png":        testPNG(t, 0),
+		"/api/img/item.png": testPNG(t, 50),
+		"/more.png":         testPNG(t, 100),
+	}
+	server := testSite(t, files)
+
+	saved := func(entries []ManifestEntry) []string {
+		var urls []string
+		for _, entry := range entries {
+			if entry.Status == statusSaved {
+				urls = append(urls, strings.TrimPrefix(entry.URL, server.URL))
+			}
+		}
+		return urls
+	}
+
+	tests := []struct {
+		name      string
+		configure func(*Spider)
+		want      []string
+	}{
+		{
+			// the endpoints named by an endpoint are not fetched
+			name:      "recursive",
+			configure: func(spider *Spider) { spider.endpoints = true },
+			want:      []string{"/cover.png", "/api/img/item.png"},
+		},
+		{
+			name:      "not recursive",
+			configure: func(spider *Spider) { spider.endpoints, spider.rFlag = true, false },
+			want:      nil,
+		},
+		{
+			name:      "disabled",
+			configure: func(spider *Spider) { spider.endpoints = false },
+			want:      nil,
+		},
+		{
+			name: "filtered",
+			configure: func(spider *Spider) {
+				spider.endpoints = true
+				spider.traps = newTrapGuard()
+				spider.traps.maxPathDepth = 1
+			},
+			want: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := testCrawl(t, server.URL+"/", t.TempDir(), test.configure)
+			if got := saved(entries); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("saved %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Seed is one starting point of the crawl, with its own scope and download
+// directory. Everything else (client, dedup, traps, reports) is shared.
+type Seed struct {
+	arg       string
+	url       string
+	baseUrl   *url.URL
+	dir       string
+	localRoot string
+	har       *harTransport
+	stats     seedStats
+}
+
+type seedStats struct {
+	pages, saved, duplicates, rejected, errors int
+}
+
+func (s *seedStats) count(status string) {
+	if s == nil {
+		return
+	}
+	switch status {
+	case statusSaved:
+		s.saved++
+	case statusDuplicate:
+		s.duplicates++
+	case statusNearDuplicate:
+		// counted as saved when stored, before the near-duplicates are known
+		s.saved--
+		s.duplicates++
+	case statusRejected:
+		s.rejected++
+	case statusError:
+		s.errors++
+	}
+}
+
+// readSeedFile reads one URL per line. Blank lines and comments starting
+// with # are ignored.
+func readSeedFile(seedsPath string) ([]string, error) {
+	f, err := os.Open(seedsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// a # after a space starts a comment, a # in the URL is a fragment
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, scanner.Err()
+}
+
+// newSeed resolves a seed argument: URL, directory, file:// URL or HAR file.
+// localRoot is the root of the offline sites, see localSeed.
+func newSeed(arg string, localRoot string) (*Seed, error) {
+	seed := &Seed{arg: arg, url: arg}
+	if strings.HasSuffix(strings.ToLower(arg), ".har") {
+		har, err := loadHar(arg)
+		if err != nil {
+			return nil, err
+		}
+		seed.har = har
+		seed.url = har.seed()
+	} else if root, seedUrl, ok, err := localSeed(arg, localRoot); ok {
+		if err != nil {
+			return nil, err
+		}
+		seed.localRoot = root
+		seed.url = seedUrl
+	}
+
+	baseUrl, err := extractBaseUrl(seed.url)
+	if err != nil {
+		return nil, err
+	}
+	seed.baseUrl = baseUrl
+	return seed, nil
+}
+
+var unsafeDirChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// dirName names the download subdirectory of a seed after its host, its
+// directory or its HAR file.
+func (seed *Seed) dirName() string {
+	name := seed.baseUrl.Host
+	switch {
+	case seed.har != nil:
+		name = strings.TrimSuffix(filepath.Base(seed.arg), filepath.Ext(seed.arg))
+	case seed.localRoot != "":
+		name = filepath.Base(seed.localRoot)
+	}
+	name = strings.Trim(unsafeDirChars.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		name = "seed"
+	}
+	return name
+}
+
+// prepareSeeds resolves the seeds and gives each its directory under
+// downloadDirectory. A single seed downloads in downloadDirectory itself.
+func prepareSeeds(args []string, downloadDirectory string, localRoot string) []*Seed {
+	var seeds []*Seed
+	used := make(map[string]int)
+	given := make(map[string]bool)
+	for _, arg := range args {
+		if given[arg] {
+			continue
+		}
+		given[arg] = true
+		seed, err := newSeed(arg, localRoot)
+		if err != nil {
+			fmt.Println("Invalid seed", arg+":", err)
+			continue
+		}
+		seeds = append(seeds, seed)
+	}
+	for _, seed := range seeds {
+		seed.dir = downloadDirectory
+		if len(seeds) > 1 {
+			name := seed.dirName()
+			used[name]++
+			if used[name] > 1 {
+				name = fmt.Sprintf("%s-%d", name, used[name])
+			}
+			seed.dir = filepath.Join(downloadDirectory, name)
+		}
+	}
+	return seeds
+}
+
+// crawlSeed points the spider at a seed and crawls it.
+func crawlSeed(spider *Spider, seed *Seed) error {
+	if err := os.MkdirAll(seed.dir, 0755); err != nil {
+		return err
+	}
+	spider.baseUrl = seed.baseUrl
+	spider.pFlag = seed.dir
+	spider.localRoot = seed.localRoot
+	spider.har = seed.har
+	spider.stats = &seed.stats
+
+	client, err := newHttpClient(spider)
+	if err != nil {
+		return err
+	}
+	spider.client = client
+
+	// every seed has its own scope, local ones all start at file:///
+	spider.visited_url = map[string]bool{seed.url: true}
+	if spider.har != nil {
+		crawlHar(spider)
+	} else {
+		explore_body(spider, seed.url, 1)
+	}
+	return nil
+}
+
+func printSeedSummary(seeds []*Seed) {
+	var total seedStats
+	for _, seed := range seeds {
+		s := seed.stats
+		fmt.Printf("SUMMARY: %s | %s | %d page(s), %d saved, %d duplicate(s), %d rejected, %d error(s)\n",
+			seed.arg, seed.dir, s.pages, s.saved, s.duplicates, s.rejected, s.errors)
+		total.pages += s.pages
+		total.saved += s.saved
+		total.duplicates += s.duplicates
+		total.rejected += s.rejected
+		total.errors += s.errors
+	}
+	if len(seeds) > 1 {
+		fmt.Printf("SUMMARY: %d seeds | %d page(s), %d saved, %d duplicate(s), %d rejected, %d error(s)\n",
+			len(seeds), total.pages, total.saved, total.duplicates, total.rejected, total.errors)
+	}
+}
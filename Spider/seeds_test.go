@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSeedFile(t *testing.T) {
+	seedsPath := filepath.Join(t.TempDir(), "seeds.txt")
+	content := "# sites to crawl\n\nhttps://a.example/\n  https://b.example/gallery#top  # the gallery\n"
+	if err := os.WriteFile(seedsPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seeds, err := readSeedFile(seedsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://a.example/", "https://b.example/gallery#top"}; !reflect.DeepEqual(seeds, want) {
+		t.Errorf("readSeedFile = %q, want %q", seeds, want)
+	}
+}
+
+func TestMultipleSeeds(t *testing.T) {
+	shared := testPNG(t, 9)
+	first := testSite(t, map[string][]byte{
+		"/":           []byte(`<html><body><img src="/a.png"><img src="/shared.png"><a href="/more.html">more</a></body></html>`),
+		"/more.html":  []byte(`<html><body><img src="/a2.png"></body></html>`),
+		"/a.png":      testPNG(t, 1),
+		"/a2.png":     testPNG(t, 2),
+		"/shared.png": shared,
+	})
+	// the second site links to the first one, out of its scope
+	second := testSite(t, map[string][]byte{
+		"/":           []byte(`<html><body><img src="/b.png"><img src="/shared.png"><a href="` + first.URL + `/more.html">elsewhere</a></body></html>`),
+		"/b.png":      testPNG(t, 3),
+		"/shared.png": shared,
+	})
+
+	dir := t.TempDir()
+	seeds := prepareSeeds([]string{first.URL + "/", second.URL + "/", first.URL + "/"}, dir, "")
+	if len(seeds) != 2 {
+		t.Fatalf("prepareSeeds gave %d seeds, want 2, the repeated one once", len(seeds))
+	}
+	for i, server := range []string{first.URL, second.URL} {
+		want := filepath.Join(dir, strings.ReplaceAll(strings.TrimPrefix(server, "http://"), ":", "_"))
+		if seeds[i].dir != want {
+			t.Errorf("seed %s downloads in %s, want %s", seeds[i].arg, seeds[i].dir, want)
+		}
+	}
+
+	spider := newTestSpider(t)
+	spider.seen_hash = make(map[string]string)
+	spider.image_links = make(map[string]bool)
+	spider.traps = newTrapGuard()
+	spider.progress = newProgress(progressOff, 0, nil)
+	for _, seed := range seeds {
+		if err := crawlSeed(spider, seed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantFiles := [][]string{{"a.png", "a2.png", "shared.png"}, {"b.png"}}
+	wantStats := []seedStats{{pages: 2, saved: 3}, {pages: 1, saved: 1, duplicates: 1}}
+	for i, seed := range seeds {
+		files, err := filepath.Glob(filepath.Join(seed.dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range files {
+			files[j] = filepath.Base(files[j])
+		}
+		if !reflect.DeepEqual(files, wantFiles[i]) {
+			t.Errorf("seed %s stored %q, want %q", seed.arg, files, wantFiles[i])
+		}
+		if seed.stats != wantStats[i] {
+			t.Errorf("seed %s stats = %+v, want %+v", seed.arg, seed.stats, wantStats[i])
+		}
+	}
+}
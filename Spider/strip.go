@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// cleanableFormats are the formats Scorpion can remove the metadata of,
+// with its clear_jpg, clear_png, clear_gif and clear_bmp handlers. With
+// -strip-metadata the images of the other formats are not stored.
+var cleanableFormats = []string{"jpeg", "png", "gif", "bmp"}
+
+// scorpionCleanResult is the line of `scorpion -json -c`.
+type scorpionCleanResult struct {
+	Format  string `json:"format"`
+	Cleaned string `json:"cleaned"`
+	Error   string `json:"error"`
+}
+
+// stripMetadata has Scorpion write a copy of a downloaded image without its
+// metadata. It returns the path of the copy and the scan of the original,
+// for the leak report; the copy is scanned again and refused if any leak is
+// left.
+func stripMetadata(spider *Spider, filePath string) (string, *scorpionResult, error) {
+	before, err := scorpionTags(spider, filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	out, stderr, err := runScorpion(spider, "-c", filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	var result scorpionCleanResult
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if json.Unmarshal(scanner.Bytes(), &result) == nil && (result.Cleaned != "" || result.Error != "") {
+			break
+		}
+	}
+	if result.Error != "" {
+		return "", nil, fmt.Errorf("scorpion: %s", result.Error)
+	}
+	if result.Cleaned == "" && stderr != "" {
+		return "", nil, fmt.Errorf("scorpion: %s", stderr)
+	}
+	if result.Cleaned == "" {
+		return "", nil, fmt.Errorf("scorpion could not remove the metadata of %s", filePath)
+	}
+
+	after, err := scorpionTags(spider, result.Cleaned)
+	if err == nil {
+		if left := leakCategoryNames(classifyLeaks(after.Tags)); len(left) > 0 {
+			err = fmt.Errorf("metadata left after cleaning: %s", strings.Join(left, ", "))
+		}
+	}
+	if err != nil {
+		os.Remove(result.Cleaned)
+		return "", nil, err
+	}
+	return result.Cleaned, before, nil
+}
+
+// cleanableExtension is the extension Scorpion needs to pick the handler of
+// a format, "" when it has none.
+func cleanableExtension(format string) string {
+	format = normalizeFormat(format)
+	if !slices.Contains(cleanableFormats, format) {
+		return ""
+	}
+	return lookupFormat(format).extensions[0]
+}
+
+// hashFile hashes the content of a file again, after it was cleaned, and
+// returns its size.
+func hashFile(filePath string, h hash.Hash) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	h.Reset()
+	return io.Copy(h, file)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+var (
+	scorpionOnce sync.Once
+	scorpionPath string
+	scorpionErr  error
+)
+
+// testScorpion builds Scorpion from ../Scorpion once for all the tests.
+func testScorpion(t *testing.T) string {
+	t.Helper()
+	scorpionOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "spider-scorpion-")
+		if err != nil {
+			scorpionErr = err
+			return
+		}
+		scorpionPath = filepath.Join(dir, "scorpion")
+		cmd := exec.Command("go", "build", "-o", scorpionPath, ".")
+		cmd.Dir = filepath.Join("..", "Scorpion")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			scorpionErr = fmt.Errorf("%v: %s", err, out)
+		}
+	})
+	if scorpionErr != nil {
+		t.Skip("scorpion can't be built:", scorpionErr)
+	}
+	return scorpionPath
+}
+
+// exifJPEG is a JPEG whose EXIF names its artist.
+func exifJPEG(t *testing.T, artist string) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 32, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 13)
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// little-endian TIFF with an IFD0 of one Artist entry, its value after
+	// the IFD
+	value := append([]byte(artist), 0)
+	tiff := []byte("II*\x00")
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x013b)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = binary.LittleEndian.AppendUint32(tiff, uint32(len(value)))
+	tiff = binary.LittleEndian.AppendUint32(tiff, 8+2+12+4)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	tiff = append(tiff, value...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xff, 0xe1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	content := encoded.Bytes()
+	return slices.Concat(content[:2], app1, content[2:])
+}
+
+func TestStripMetadata(t *testing.T) {
+	scorpion := testScorpion(t)
+	webp := []byte("RIFF\x24\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\x1f\x03\x00\xdf\x01\x00")
+	server := testSite(t, map[string][]byte{
+		"/":           []byte(`<html><body><img src="/photo.jpg"><img src="/plain.png"><img src="/photo.webp"></body></html>`),
+		"/photo.jpg":  exifJPEG(t, "Jane Roe"),
+		"/plain.png":  testPNG(t, 1),
+		"/photo.webp": webp,
+	})
+	dir := t.TempDir()
+	spider := &Spider{scorpionBin: scorpion}
+	entries := testCrawl(t, server.URL+"/", dir, func(s *Spider) {
+		s.scorpionBin = scorpion
+		s.stripMeta = true
+	})
+	if len(entries) != 3 {
+		t.Fatalf("manifest %+v, want the 3 images of the page", entries)
+	}
+
+	for _, entry := range entries {
+		name := path.Base(entry.URL)
+		if name == "photo.webp" {
+			if want := "metadata of format webp can't be stripped"; entry.Status != statusRejected || entry.Reason != want {
+				t.Errorf("%s: %s %q, want rejected %q", name, entry.Status, entry.Reason, want)
+			}
+			continue
+		}
+		if entry.Status != statusSaved || entry.File != name {
+			t.Errorf("%s: %s %q in %q, want saved as %s", name, entry.Status, entry.Reason, entry.File, name)
+			continue
+		}
+		var want []string
+		if name == "photo.jpg" {
+			want = []string{"author"}
+		}
+		if !slices.Equal(entry.MetadataRemoved, want) {
+			t.Errorf("%s: metadata removed %q, want %q", name, entry.MetadataRemoved, want)
+		}
+
+		stored := filepath.Join(dir, entry.File)
+		content, err := os.ReadFile(stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(content, []byte("Jane Roe")) || bytes.Contains(content, []byte("Exif\x00\x00")) {
+			t.Errorf("%s: EXIF left in the stored file", name)
+		}
+		tags, err := scorpionTags(spider, stored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leaks := classifyLeaks(tags.Tags); len(leaks) > 0 {
+			t.Errorf("%s: leaks left in the stored file: %v", name, leaks)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(content)); err != nil {
+			t.Errorf("%s: stored file doesn't decode: %v", name, err)
+		}
+		if sum := fmt.Sprintf("%x", sha256.Sum256(content)); entry.SHA256 != sum || entry.Size != int64(len(content)) {
+			t.Errorf("%s: manifest sha256 %s and size %d, want the ones of the stored file, %s and %d", name, entry.SHA256, entry.Size, sum, len(content))
+		}
+	}
+
+	if leftover, _ := filepath.Glob(filepath.Join(dir, ".spider-*")); len(leftover) > 0 {
+		t.Errorf("temporary files left: %q", leftover)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseRate reads a rate in bytes per second: 500000, 500K or 1.5M. An empty
+// rate is no limit.
+func parseRate(rate string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(rate))
+	if value == "" {
+		return 0, nil
+	}
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "/S"), "B")
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	// no digits left, like "K" or "MB/s", is an error too
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid rate %q, expected bytes per second like 500K or 2M", rate)
+	}
+	return int64(n * multiplier), nil
+}
+
+// bucket is a token bucket holding at most one second of its rate. It starts
+// empty, so that the rate is never above the limit from the start.
+type bucket struct {
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{rate: rate, last: time.Now()}
+}
+
+// take removes n tokens and returns how long to wait before they are paid
+// back.
+func (b *bucket) take(n int, now time.Time) time.Duration {
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*float64(b.rate), float64(b.rate))
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// Throttle caps the bandwidth of the downloads, for all the hosts together
+// and for each host. A nil *Throttle does not limit anything.
+type Throttle struct {
+	mu       sync.Mutex
+	global   *bucket
+	hostRate int64
+	hosts    map[string]*bucket
+
+	bytes  int64
+	waited time.Duration
+	// throughput measured for the progress display
+	sampled      time.Time
+	sampledBytes int64
+	current      float64
+}
+
+func newThrottle(rate int64, hostRate int64) *Throttle {
+	if rate <= 0 && hostRate <= 0 {
+		return nil
+	}
+	t := &Throttle{hostRate: hostRate, hosts: make(map[string]*bucket), sampled: time.Now()}
+	if rate > 0 {
+		t.global = newBucket(rate)
+	}
+	return t
+}
+
+// chunk is the most read at once, small enough to keep the rate smooth.
+func (t *Throttle) chunk() int {
+	rate := t.hostRate
+	if t.global != nil && (rate <= 0 || t.global.rate < rate) {
+		rate = t.global.rate
+	}
+	return int(min(max(rate/10, 512), 32*1024))
+}
+
+// Wait blocks until n more bytes can be downloaded from host.
+func (t *Throttle) Wait(host string, n int) {
+	t.mu.Lock()
+	now := time.Now()
+	var delay time.Duration
+	if t.global != nil {
+		delay = t.global.take(n, now)
+	}
+	if t.hostRate > 0 {
+		b := t.hosts[host]
+		if b == nil {
+			b = newBucket(t.hostRate)
+			t.hosts[host] = b
+		}
+		delay = max(delay, b.take(n, now))
+	}
+	t.bytes += int64(n)
+	t.waited += delay
+	t.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// Status is the part of the progress line about the limits and the
+// throughput they leave.
+func (t *Throttle) Status() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if elapsed := now.Sub(t.sampled); elapsed >= time.Second {
+		t.current = float64(t.bytes-t.sampledBytes) / elapsed.Seconds()
+		t.sampled, t.sampledBytes = now, t.bytes
+	}
+	return fmt.Sprintf("limit %s: %s/s, waited %s", t.limits(), humanSize(int64(t.current)), t.waited.Round(time.Second))
+}
+
+func (t *Throttle) limits() string {
+	var limits []string
+	if t.global != nil {
+		limits = append(limits, humanSize(t.global.rate)+"/s")
+	}
+	if t.hostRate > 0 {
+		limits = append(limits, humanSize(t.hostRate)+"/s per host")
+	}
+	return strings.Join(limits, ", ")
+}
+
+// Waited is the time spent waiting for the limits.
+func (t *Throttle) Waited() time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waited
+}
+
+// throttledReader reads a response body no faster than the throttle allows.
+type throttledReader struct {
+	body     io.ReadCloser
+	throttle *Throttle
+	host     string
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if chunk := r.throttle.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.throttle.Wait(r.host, n)
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.body.Close()
+}
+
+// throttleTransport limits the bodies of the http(s) responses, pages and
+// images alike. It is the closest to the network so that the transports
+// reading the whole body (WARC, record, evidence) are limited too.
+type throttleTransport struct {
+	next     http.RoundTripper
+	throttle *Throttle
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		return resp, err
+	}
+	resp.Body = &throttledReader{body: resp.Body, throttle: t.throttle, host: req.URL.Host}
+	return resp, nil
+}
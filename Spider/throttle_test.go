@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate    string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"  ", 0, false},
+		{"500000", 500000, false},
+		{"500K", 500 << 10, false},
+		{"500k", 500 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{"2MB/s", 2 << 20, false},
+		{"1G", 1 << 30, false},
+		{"100B", 100, false},
+		{"0", 0, false},
+		{"K", 0, true},
+		{"MB/s", 0, true},
+		{"B", 0, true},
+		{"5KK", 0, true},
+		{"-1M", 0, true},
+		{"fast", 0, true},
+		{"inf", 0, true},
+		{"NaN", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseRate(test.rate)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("parseRate(%q) = %d, %v, want %d, error %v", test.rate, got, err, test.want, test.wantErr)
+		}
+	}
+}
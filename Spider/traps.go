@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	trapUrlLength     = "url-length"
+	trapPathDepth     = "path-depth"
+	trapRepeats       = "repeated-segments"
+	trapQueryVariants = "query-variants"
+	trapPatternBudget = "pattern-budget"
+)
+
+// TrapGuard skips the links of calendars, faceted searches and endless
+// archives, which generate new URLs for ever. Zero limits are disabled.
+type TrapGuard struct {
+	maxUrlLength     int
+	maxPathDepth     int
+	maxRepeats       int
+	maxQueryVariants int
+	patternBudget    int
+
+	variants  map[string]map[string]bool
+	patterns  map[string]int
+	skipped   map[string]int
+	announced map[string]bool
+}
+
+func newTrapGuard() *TrapGuard {
+	return &TrapGuard{
+		variants:  make(map[string]map[string]bool),
+		patterns:  make(map[string]int),
+		skipped:   make(map[string]int),
+		announced: make(map[string]bool),
+	}
+}
+
+var digitRun = regexp.MustCompile(`\d+`)
+
+// urlPattern generalizes the numbers of a URL, so /2024/05/12 and
+// /2023/11/02 of the same calendar share /{n}/{n}/{n}. Query values are
+// left out, only their names are kept.
+func urlPattern(u *url.URL) string {
+	keys := slices.Sorted(maps.Keys(u.Query()))
+	pattern := u.Host + digitRun.ReplaceAllString(u.Path, "{n}")
+	if len(keys) > 0 {
+		pattern += "?" + strings.Join(keys, "&")
+	}
+	return pattern
+}
+
+func pathSegments(u *url.URL) []string {
+	var segments []string
+	for segment := range strings.SplitSeq(u.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// repeatedSegments tells if a block of segments comes back repeats times in
+// a row, like /a/b/a/b/a/b.
+func repeatedSegments(segments []string, repeats int) bool {
+	for size := 1; size*repeats <= len(segments); size++ {
+		for start := 0; start+size*repeats <= len(segments); start++ {
+			block := segments[start : start+size]
+			n := 1
+			for n < repeats && slices.Equal(block, segments[start+n*size:start+(n+1)*size]) {
+				n++
+			}
+			if n == repeats {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check returns the trap the link falls in, or "" when it can be crawled.
+// Accepted links count in the budget of their pattern.
+func (t *TrapGuard) Check(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	pattern := urlPattern(u)
+	trap, detail := t.match(u, rawURL, pattern)
+	if trap == "" {
+		return ""
+	}
+
+	t.skipped[trap]++
+	if key := trap + " " + pattern; !t.announced[key] {
+		t.announced[key] = true
+		fmt.Printf("TRAP: %s | %s (%s), skipping similar links\n", rawURL, trap, detail)
+	}
+	return trap
+}
+
+func (t *TrapGuard) match(u *url.URL, rawURL string, pattern string) (string, string) {
+	if t.maxUrlLength > 0 && len(rawURL) > t.maxUrlLength {
+		return trapUrlLength, fmt.Sprintf("%d > %d characters", len(rawURL), t.maxUrlLength)
+	}
+	segments := pathSegments(u)
+	if t.maxPathDepth > 0 && len(segments) > t.maxPathDepth {
+		return trapPathDepth, fmt.Sprintf("%d > %d segments", len(segments), t.maxPathDepth)
+	}
+	if t.maxRepeats > 1 && repeatedSegments(segments, t.maxRepeats) {
+		return trapRepeats, fmt.Sprintf("segments repeated %d times", t.maxRepeats)
+	}
+
+	// the query string and the page of the pattern are only counted once
+	// the link is accepted
+	var seen map[string]bool
+	if u.RawQuery != "" && t.maxQueryVariants > 0 {
+		path := u.Host + u.Path
+		seen = t.variants[path]
+		if seen == nil {
+			seen = make(map[string]bool)
+			t.variants[path] = seen
+		}
+		if !seen[u.RawQuery] && len(seen) >= t.maxQueryVariants {
+			return trapQueryVariants, fmt.Sprintf("more than %d query strings for %s", t.maxQueryVariants, path)
+		}
+	}
+	if t.patternBudget > 0 && t.patterns[pattern] >= t.patternBudget {
+		return trapPatternBudget, fmt.Sprintf("more than %d pages like %s", t.patternBudget, pattern)
+	}
+
+	if seen != nil {
+		seen[u.RawQuery] = true
+	}
+	if t.patternBudget > 0 {
+		t.patterns[pattern]++
+	}
+	return "", ""
+}
+
+// Report prints how many links each trap skipped.
+func (t *TrapGuard) Report() {
+	traps := make([]string, 0, len(t.skipped))
+	for trap := range t.skipped {
+		traps = append(traps, trap)
+	}
+	sort.Strings(traps)
+	for _, trap := range traps {
+		fmt.Printf("TRAPS: %s | %d link(s) skipped\n", trap, t.skipped[trap])
+	}
+}
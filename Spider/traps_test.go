@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTrapGuardDefaults(t *testing.T) {
+	guard := newTrapGuard()
+	for _, link := range []string{
+		"http://a/" + string(make([]byte, 3000)),
+		"http://a/1/2/3/4/5/6/7/8/9/10/11/12/13/14/15/16/17/18/19/20/21/22",
+		"http://a/x/y/x/y/x/y/x/y",
+	} {
+		if trap := guard.Check(link); trap != "" {
+			t.Errorf("Check(%.40q) = %s, want no trap by default", link, trap)
+		}
+	}
+}
+
+func TestTrapGuard(t *testing.T) {
+	guard := newTrapGuard()
+	guard.maxUrlLength = 40
+	guard.maxPathDepth = 6
+	guard.maxRepeats = 3
+	guard.maxQueryVariants = 2
+	guard.patternBudget = 3
+
+	tests := []struct {
+		link string
+		trap string
+	}{
+		{"http://a/page", ""},
+		{"http://a/very/long/path/that/goes/on/and/on", trapUrlLength},
+		{"http://a/1/2/3/4/5/6/7", trapPathDepth},
+		{"http://a/x/y/x/y/x/y", trapRepeats},
+		{"http://a/x/y/x/y", ""},
+		{"http://a/s?q=1", ""},
+		{"http://a/s?q=2", ""},
+		{"http://a/s?q=1", ""},
+		{"http://a/s?q=3", trapQueryVariants},
+		{"http://a/day/1", ""},
+		{"http://a/day/2", ""},
+		{"http://a/day/3", ""},
+		{"http://a/day/4", trapPatternBudget},
+	}
+	for _, test := range tests {
+		if trap := guard.Check(test.link); trap != test.trap {
+			t.Errorf("Check(%s) = %q, want %q", test.link, trap, test.trap)
+		}
+	}
+}
+
+func TestTrapGuardCountsAcceptedLinksOnly(t *testing.T) {
+	guard := newTrapGuard()
+	guard.maxQueryVariants = 2
+	guard.patternBudget = 1
+
+	if trap := guard.Check("http://a/s?q=1"); trap != "" {
+		t.Fatalf("first link: %s", trap)
+	}
+	if trap := guard.Check("http://a/s?q=2"); trap != trapPatternBudget {
+		t.Fatalf("second link: %q, want %s", trap, trapPatternBudget)
+	}
+	if n := len(guard.variants["a/s"]); n != 1 {
+		t.Errorf("%d query string(s) counted, want only the accepted one", n)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// WarcWriter writes WARC/1.1 records, one gzip member per record, and
+// rotates to a new file once maxSize bytes have been written.
+type WarcWriter struct {
+	dir     string
+	maxSize int64
+	started time.Time
+	seq     int
+	file    *os.File
+	name    string
+	size    int64
+}
+
+type warcHeader struct {
+	key   string
+	value string
+}
+
+func newWarcWriter(dir string, maxSize int64) (*WarcWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &WarcWriter{dir: dir, maxSize: maxSize, started: time.Now().UTC()}, nil
+}
+
+func (w *WarcWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *WarcWriter) rotate() error {
+	if err := w.Close(); err != nil {
+		return err
+	}
+	w.name = fmt.Sprintf("spider-%s-%05d.warc.gz", w.started.Format("20060102150405"), w.seq)
+	w.seq++
+	f, err := os.Create(filepath.Join(w.dir, w.name))
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.size = 0
+
+	info := "software: spider (Arachnida)\r\n" +
+		"format: WARC File Format 1.1\r\n" +
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	return w.appendRecord([]warcHeader{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newWarcRecordID()},
+		{"WARC-Date", warcDate(time.Now())},
+		{"WARC-Filename", w.name},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info))
+}
+
+func (w *WarcWriter) rotateIfFull() error {
+	if w.file == nil || w.size >= w.maxSize {
+		return w.rotate()
+	}
+	return nil
+}
+
+func (w *WarcWriter) appendRecord(headers []warcHeader, block []byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprint(gz, "WARC/1.1\r\n")
+	for _, h := range headers {
+		fmt.Fprintf(gz, "%s: %s\r\n", h.key, h.value)
+	}
+	fmt.Fprintf(gz, "Content-Length: %d\r\n\r\n", len(block))
+	gz.Write(block)
+	fmt.Fprint(gz, "\r\n\r\n")
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// WriteExchange records a request/response pair for targetURI. Both records
+// always land in the same file.
+func (w *WarcWriter) WriteExchange(targetURI string, date time.Time, request []byte, response []byte, payload []byte) error {
+	if err := w.rotateIfFull(); err != nil {
+		return err
+	}
+	requestID := newWarcRecordID()
+	responseID := newWarcRecordID()
+
+	err := w.appendRecord([]warcHeader{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", warcDate(date)},
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Block-Digest", warcDigest(response)},
+		{"WARC-Payload-Digest", warcDigest(payload)},
+		{"Content-Type", "application/http;msgtype=response"},
+	}, response)
+	if err != nil {
+		return err
+	}
+
+	return w.appendRecord([]warcHeader{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", requestID},
+		{"WARC-Date", warcDate(date)},
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Concurrent-To", responseID},
+		{"WARC-Block-Digest", warcDigest(request)},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, request)
+}
+
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func warcDigest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func newWarcRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// warcTransport archives every http(s) exchange going through the client.
+type warcTransport struct {
+	next http.RoundTripper
+	warc *WarcWriter
+}
+
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return t.next.RoundTrip(req)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", "Go-http-client/1.1")
+	}
+
+	date := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(payload))
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.URL.Host)
+	req.Header.Write(&request)
+	request.WriteString("\r\n")
+
+	// the payload stored is de-chunked, and decompressed when the transport
+	// asked for gzip itself: the headers must describe it as stored
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	if resp.Uncompressed {
+		header.Del("Content-Encoding")
+	}
+	header.Set("Content-Length", strconv.Itoa(len(payload)))
+
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "%s %s\r\n", resp.Proto, resp.Status)
+	header.Write(&response)
+	response.WriteString("\r\n")
+	response.Write(payload)
+
+	if err := t.warc.WriteExchange(req.URL.String(), date, request.Bytes(), response.Bytes(), payload); err != nil {
+		log.Printf("WARC: %v\n", err)
+	}
+	return resp, nil
+}
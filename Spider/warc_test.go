@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// warcResponses returns the HTTP responses of the response records of the
+// WARC files of dir, with their bodies read.
+func warcResponses(t *testing.T, dir string) map[*http.Response][]byte {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no WARC file in %s: %v", dir, err)
+	}
+	responses := make(map[*http.Response][]byte)
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range strings.Split(string(content), "WARC/1.1\r\n")[1:] {
+			headers, block, _ := strings.Cut(record, "\r\n\r\n")
+			if !strings.Contains(headers, "WARC-Type: response") {
+				continue
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(block)), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading the body of %s: %v", resp.Status, err)
+			}
+			responses[resp] = body
+		}
+	}
+	return responses
+}
+
+func TestWarcResponseHeaders(t *testing.T) {
+	page := strings.Repeat("<p>archived</p>", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(page))
+			gz.Close()
+			return
+		}
+		// flushed before the end, sent chunked
+		io.WriteString(w, page[:10])
+		w.(http.Flusher).Flush()
+		io.WriteString(w, page[10:])
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		transport *http.Transport
+	}{
+		{"gzip", &http.Transport{}},
+		{"chunked", &http.Transport{DisableCompression: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			warc, err := newWarcWriter(dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &warcTransport{next: test.transport, warc: warc}}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			warc.Close()
+			if string(got) != page {
+				t.Fatalf("the client got %q", got)
+			}
+
+			responses := warcResponses(t, dir)
+			if len(responses) != 1 {
+				t.Fatalf("%d response record(s), want 1", len(responses))
+			}
+			for archived, body := range responses {
+				if !bytes.Equal(body, []byte(page)) {
+					t.Errorf("archived body %q, want the page", body)
+				}
+				if encoding := archived.Header.Get("Content-Encoding"); encoding != "" {
+					t.Errorf("archived Content-Encoding %q for a decompressed body", encoding)
+				}
+				if len(archived.TransferEncoding) > 0 {
+					t.Errorf("archived Transfer-Encoding %v for a de-chunked body", archived.TransferEncoding)
+				}
+				if length := archived.Header.Get("Content-Length"); length != strconv.Itoa(len(page)) {
+					t.Errorf("archived Content-Length %q, want %d", length, len(page))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// IndexedImage is an image found by a crawl, with its content hash.
+type IndexedImage struct {
+	URL    string `json:"url"`
+	Page   string `json:"page,omitempty"`
+	File   string `json:"file,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// IndexedPage is a page of a crawl with the images found in it.
+type IndexedPage struct {
+	URL    string   `json:"url"`
+	Status int      `json:"status,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	Images []string `json:"images,omitempty"`
+}
+
+// ImageIndex is what a crawl found, kept by watch to compare the crawls.
+// A nil *ImageIndex records nothing.
+type ImageIndex struct {
+	Time   string                   `json:"time"`
+	Pages  map[string]*IndexedPage  `json:"pages"`
+	Images map[string]*IndexedImage `json:"images"`
+}
+
+func newImageIndex() *ImageIndex {
+	return &ImageIndex{
+		Time:   eventTime(),
+		Pages:  make(map[string]*IndexedPage),
+		Images: make(map[string]*IndexedImage),
+	}
+}
+
+// loadImageIndex reads the index saved by the previous watch, nil if there
+// is none.
+func loadImageIndex(indexPath string) (*ImageIndex, error) {
+	content, err := os.ReadFile(indexPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := newImageIndex()
+	if err := json.Unmarshal(content, index); err != nil {
+		return nil, fmt.Errorf("%s: %v", indexPath, err)
+	}
+	return index, nil
+}
+
+func (x *ImageIndex) Save(indexPath string) error {
+	content, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexPath, content, 0644)
+}
+
+func (x *ImageIndex) page(pageUrl string) *IndexedPage {
+	page := x.Pages[pageUrl]
+	if page == nil {
+		page = &IndexedPage{URL: pageUrl}
+		x.Pages[pageUrl] = page
+	}
+	return page
+}
+
+// Page records a fetched page, reason is the error when it could not be.
+func (x *ImageIndex) Page(pageUrl string, status int, reason string) {
+	if x == nil {
+		return
+	}
+	page := x.page(pageUrl)
+	page.Status = status
+	page.Error = reason
+}
+
+// Image records the images found, whether saved or already saved under
+// another URL, and the ones that failed.
+func (x *ImageIndex) Image(entry ManifestEntry) {
+	if x == nil {
+		return
+	}
+	switch entry.Status {
+	case statusSaved, statusDuplicate, statusError:
+	default:
+		return
+	}
+	key := indexKey(entry)
+	if _, ok := x.Images[key]; ok {
+		return
+	}
+	x.Images[key] = &IndexedImage{entry.URL, entry.Page, entry.File, entry.SHA256, entry.Size, entry.Reason}
+	if entry.Page != "" {
+		page := x.page(entry.Page)
+		page.Images = append(page.Images, key)
+	}
+}
+
+// indexKey is the URL of the image, or its page and content for the images
+// having no URL of their own (data: URIs, inline SVG).
+func indexKey(entry ManifestEntry) string {
+	if (isDataURI(entry.URL) || entry.Source == "inline-svg") && entry.SHA256 != "" {
+		return entry.Page + "#" + entry.SHA256[:16]
+	}
+	return entry.URL
+}
+
+type imageChange struct {
+	URL      string `json:"url"`
+	Page     string `json:"page,omitempty"`
+	File     string `json:"file,omitempty"`
+	Previous string `json:"previous_sha256"`
+	SHA256   string `json:"sha256"`
+}
+
+type pageChange struct {
+	URL            string   `json:"url"`
+	PreviousStatus int      `json:"previous_status"`
+	Status         int      `json:"status"`
+	Error          string   `json:"error,omitempty"`
+	NewImages      []string `json:"new_images,omitempty"`
+	RemovedImages  []string `json:"removed_images,omitempty"`
+}
+
+// WatchDiff is what changed between two crawls.
+type WatchDiff struct {
+	Event         string          `json:"event"`
+	Time          string          `json:"time"`
+	Previous      string          `json:"previous"`
+	Seeds         []string        `json:"seeds"`
+	NewImages     []*IndexedImage `json:"new_images"`
+	RemovedImages []*IndexedImage `json:"removed_images"`
+	ChangedImages []imageChange   `json:"changed_images"`
+	NewPages      []string        `json:"new_pages"`
+	RemovedPages  []string        `json:"removed_pages"`
+	ChangedPages  []pageChange    `json:"changed_pages"`
+}
+
+func (d *WatchDiff) Empty() bool {
+	return len(d.NewImages)+len(d.RemovedImages)+len(d.ChangedImages)+
+		len(d.NewPages)+len(d.RemovedPages)+len(d.ChangedPages) == 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffImageIndexes compares a crawl to the previous one. The images of the
+// pages that could not be fetched this time, and the images that failed, are
+// not reported removed: nothing says they are gone.
+func diffImageIndexes(previous, current *ImageIndex) *WatchDiff {
+	diff := &WatchDiff{
+		Event:         eventWatchDiff,
+		Time:          current.Time,
+		Previous:      previous.Time,
+		NewImages:     []*IndexedImage{},
+		RemovedImages: []*IndexedImage{},
+		ChangedImages: []imageChange{},
+		NewPages:      []string{},
+		RemovedPages:  []string{},
+		ChangedPages:  []pageChange{},
+	}
+
+	for _, key := range sortedKeys(current.Images) {
+		image := current.Images[key]
+		before, ok := previous.Images[key]
+		switch {
+		case image.Error != "":
+		case !ok || before.Error != "":
+			diff.NewImages = append(diff.NewImages, image)
+		case image.SHA256 != before.SHA256:
+			diff.ChangedImages = append(diff.ChangedImages, imageChange{image.URL, image.Page, image.File, before.SHA256, image.SHA256})
+		}
+	}
+	for _, key := range sortedKeys(previous.Images) {
+		image := previous.Images[key]
+		if _, ok := current.Images[key]; ok || image.Error != "" {
+			continue
+		}
+		if page := current.Pages[image.Page]; page != nil && page.Error != "" {
+			continue
+		}
+		diff.RemovedImages = append(diff.RemovedImages, image)
+	}
+
+	for _, pageUrl := range sortedKeys(current.Pages) {
+		page := current.Pages[pageUrl]
+		before, ok := previous.Pages[pageUrl]
+		if !ok {
+			diff.NewPages = append(diff.NewPages, pageUrl)
+			continue
+		}
+		change := pageChange{URL: pageUrl, PreviousStatus: before.Status, Status: page.Status, Error: page.Error}
+		if page.Error == "" {
+			for _, key := range page.Images {
+				if !slices.Contains(before.Images, key) {
+					change.NewImages = append(change.NewImages, key)
+				}
+			}
+			for _, key := range before.Images {
+				if !slices.Contains(page.Images, key) {
+					change.RemovedImages = append(change.RemovedImages, key)
+				}
+			}
+		}
+		if change.Status != change.PreviousStatus || change.NewImages != nil || change.RemovedImages != nil {
+			diff.ChangedPages = append(diff.ChangedPages, change)
+		}
+	}
+	for _, pageUrl := range sortedKeys(previous.Pages) {
+		if _, ok := current.Pages[pageUrl]; !ok {
+			diff.RemovedPages = append(diff.RemovedPages, pageUrl)
+		}
+	}
+	return diff
+}
+
+func (d *WatchDiff) Write(diffPath string) error {
+	content, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(diffPath, content, 0644)
+}
+
+// Post sends the diff as JSON to a webhook.
+func (d *WatchDiff) Post(webhook string, client *http.Client) error {
+	content, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webhook %s: bad status: %s", webhook, resp.Status)
+	}
+	return nil
+}
+
+type watchOptions struct {
+	dir      string // the -p directory, where the index and the diffs go
+	interval time.Duration
+	runs     int
+	webhook  string
+	seeds    []string
+}
+
+// watch crawls every interval and reports what changed since the crawl
+// before. The index of the last crawl is kept in the -p directory, so a
+// watch started again compares to where the previous one stopped.
+func watch(spider *Spider, crawl func(), opts watchOptions) error {
+	indexPath := filepath.Join(opts.dir, "index.json")
+	diffDir := filepath.Join(opts.dir, "diffs")
+	if err := os.MkdirAll(diffDir, 0755); err != nil {
+		return err
+	}
+	previous, err := loadImageIndex(indexPath)
+	if err != nil {
+		return err
+	}
+
+	for run := 1; ; run++ {
+		spider.index = newImageIndex()
+		crawl()
+		if previous == nil {
+			fmt.Printf("WATCH: first crawl, %d image(s) and %d page(s) indexed\n", len(spider.index.Images), len(spider.index.Pages))
+		} else {
+			diff := diffImageIndexes(previous, spider.index)
+			diff.Seeds = opts.seeds
+			stamp, _ := time.Parse(time.RFC3339Nano, diff.Time)
+			diffPath := filepath.Join(diffDir, "diff-"+stamp.Format("20060102T150405Z")+".json")
+			if err := diff.Write(diffPath); err != nil {
+				return err
+			}
+			fmt.Printf("WATCH: %d new, %d removed, %d changed image(s) | %d new, %d removed, %d changed page(s) | %s\n",
+				len(diff.NewImages), len(diff.RemovedImages), len(diff.ChangedImages),
+				len(diff.NewPages), len(diff.RemovedPages), len(diff.ChangedPages), diffPath)
+			spider.events.WatchDiff(diff)
+			if opts.webhook != "" && !diff.Empty() {
+				if err := diff.Post(opts.webhook, &http.Client{Timeout: 30 * time.Second}); err != nil {
+					fmt.Println("WATCH:", err)
+				}
+			}
+		}
+		if err := spider.index.Save(indexPath); err != nil {
+			return err
+		}
+		previous = spider.index
+
+		if opts.runs > 0 && run >= opts.runs {
+			return nil
+		}
+		fmt.Println("WATCH: next crawl at", time.Now().Add(opts.interval).Format(time.DateTime))
+		time.Sleep(opts.interval)
+	}
+}
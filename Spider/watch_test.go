@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func imageURLs(images []*IndexedImage) []string {
+	var urls []string
+	for _, image := range images {
+		urls = append(urls, image.URL)
+	}
+	return urls
+}
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	files := map[string][]byte{
+		"/":          []byte(`<img src="/a.png"><img src="/b.png"><a href="/page.html">page</a>`),
+		"/page.html": []byte(`<img src="/a.png">`),
+		"/a.png":     testPNG(t, 0),
+		"/b.png":     testPNG(t, 50),
+	}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		serveTestFile(w, r, files)
+	}))
+	defer site.Close()
+
+	var posts [][]byte
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		mu.Lock()
+		posts = append(posts, body)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	dir := t.TempDir()
+	spider := newTestSpider(t)
+	run := 0
+	crawl := func() {
+		crawlTestSeed(t, spider, site.URL+"/", dir)
+		run++
+		if run == 1 {
+			// between the crawls a.png changes, b.png and page.html go away
+			// and c.png comes
+			mu.Lock()
+			files["/"] = []byte(`<img src="/a.png"><img src="/c.png">`)
+			files["/a.png"] = testPNG(t, 10)
+			files["/c.png"] = testPNG(t, 100)
+			delete(files, "/b.png")
+			delete(files, "/page.html")
+			mu.Unlock()
+		}
+	}
+	err := watch(spider, crawl, watchOptions{dir: dir, runs: 2, webhook: webhook.URL, seeds: []string{site.URL + "/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := filepath.Glob(filepath.Join(dir, "diffs", "diff-*.json"))
+	if err != nil || len(diffs) != 1 {
+		t.Fatalf("diffs %v, want one: %v", diffs, err)
+	}
+	content, err := os.ReadFile(diffs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff WatchDiff
+	if err := json.Unmarshal(content, &diff); err != nil {
+		t.Fatal(err)
+	}
+
+	root, page := site.URL+"/", site.URL+"/page.html"
+	if got := imageURLs(diff.NewImages); !reflect.DeepEqual(got, []string{site.URL + "/c.png"}) {
+		t.Errorf("new images %v", got)
+	}
+	if got := imageURLs(diff.RemovedImages); !reflect.DeepEqual(got, []string{site.URL + "/b.png"}) {
+		t.Errorf("removed images %v", got)
+	}
+	if len(diff.ChangedImages) != 1 || diff.ChangedImages[0].URL != site.URL+"/a.png" || diff.ChangedImages[0].Previous == diff.ChangedImages[0].SHA256 {
+		t.Errorf("changed images %+v", diff.ChangedImages)
+	}
+	if !reflect.DeepEqual(diff.RemovedPages, []string{page}) || len(diff.NewPages) != 0 {
+		t.Errorf("new pages %v, removed pages %v", diff.NewPages, diff.RemovedPages)
+	}
+	wantPage := []pageChange{{
+		URL: root, PreviousStatus: http.StatusOK, Status: http.StatusOK,
+		NewImages:     []string{site.URL + "/c.png"},
+		RemovedImages: []string{site.URL + "/b.png"},
+	}}
+	if !reflect.DeepEqual(diff.ChangedPages, wantPage) {
+		t.Errorf("changed pages %+v, want %+v", diff.ChangedPages, wantPage)
+	}
+
+	if len(posts) != 1 {
+		t.Fatalf("%d webhook POST(s), want 1", len(posts))
+	}
+	var posted WatchDiff
+	if err := json.Unmarshal(posts[0], &posted); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(posted, diff) {
+		t.Errorf("webhook got %s\nwant %s", posts[0], content)
+	}
+}
+
+func TestDiffImageIndexes(t *testing.T) {
+	index := func(pages map[string]*IndexedPage, images ...*IndexedImage) *ImageIndex {
+		x := newImageIndex()
+		for url, page := range pages {
+			page.URL = url
+			x.Pages[url] = page
+		}
+		for _, image := range images {
+			x.Images[image.URL] = image
+		}
+		return x
+	}
+	ok := map[string]*IndexedPage{"p": {Status: 200}}
+	tests := []struct {
+		name              string
+		previous, current *ImageIndex
+		removed, added    []string
+		changed           int
+	}{
+		{
+			name:     "same",
+			previous: index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+			current:  index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+		},
+		{
+			name:     "changed",
+			previous: index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+			current:  index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "2"}),
+			changed:  1,
+		},
+		{
+			name:     "replaced",
+			previous: index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+			current:  index(ok, &IndexedImage{URL: "b", Page: "p", SHA256: "1"}),
+			removed:  []string{"a"},
+			added:    []string{"b"},
+		},
+		{
+			name:     "page down",
+			previous: index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+			current:  index(map[string]*IndexedPage{"p": {Status: 503, Error: "503 Service Unavailable"}}),
+		},
+		{
+			name:     "image failing",
+			previous: index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+			current:  index(ok, &IndexedImage{URL: "a", Page: "p", Error: "timeout"}),
+		},
+		{
+			name:     "image back",
+			previous: index(ok, &IndexedImage{URL: "a", Page: "p", Error: "timeout"}),
+			current:  index(ok, &IndexedImage{URL: "a", Page: "p", SHA256: "1"}),
+			added:    []string{"a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := diffImageIndexes(test.previous, test.current)
+			if got := imageURLs(diff.RemovedImages); !reflect.DeepEqual(got, test.removed) {
+				t.Errorf("removed %v, want %v", got, test.removed)
+			}
+			if got := imageURLs(diff.NewImages); !reflect.DeepEqual(got, test.added) {
+				t.Errorf("new %v, want %v", got, test.added)
+			}
+			if len(diff.ChangedImages) != test.changed {
+				t.Errorf("%d changed, want %d", len(diff.ChangedImages), test.changed)
+			}
+		})
+	}
+}